@@ -0,0 +1,133 @@
+// Package bloom is a scalable Bloom filter of SHA-256 checksums.
+//
+// A Bloom filter uses a fixed number of bits for each item, regardless of the item size,
+// but it can report false positives, which are items that were never added.
+// The filter grows with new layers as items are added to keep the false positive rate.
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// capacity is the number of items of the first layer.
+	capacity = 1 << 20
+	// growth is the capacity multiplier of each new layer.
+	growth = 2
+	// tighten is the false positive rate multiplier of each new layer,
+	// which keeps the overall rate within twice the requested rate.
+	tighten = 0.5
+	// Rate is the default false positive rate.
+	Rate = 0.001
+)
+
+type (
+	// Filter is a scalable Bloom filter.
+	Filter struct {
+		Rate   float64 // Rate is the requested false positive rate of the filter.
+		Layers []Layer // Layers of the filter, each new layer has a larger capacity.
+	}
+	// Layer is a fixed size Bloom filter.
+	Layer struct {
+		Bits []uint64 // Bits is the bit array.
+		M    uint64   // M is the number of bits.
+		K    uint64   // K is the number of hash functions.
+		N    int      // N is the number of added items.
+		Cap  int      // Cap is the number of items before the layer is full.
+	}
+)
+
+// New returns an empty Bloom filter with the false positive rate.
+// An invalid rate uses the default Rate.
+func New(rate float64) *Filter {
+	if rate <= 0 || rate >= 1 {
+		rate = Rate
+	}
+	return &Filter{Rate: rate}
+}
+
+// Has reports whether the checksum is possibly in the filter.
+func (f *Filter) Has(sum [32]byte) bool {
+	for i := range f.Layers {
+		if f.Layers[i].has(sum) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add the checksum to the filter.
+func (f *Filter) Add(sum [32]byte) {
+	if len(f.Layers) == 0 || f.last().N >= f.last().Cap {
+		n := len(f.Layers)
+		c := capacity * int(math.Pow(growth, float64(n)))
+		p := f.Rate * (1 - tighten) * math.Pow(tighten, float64(n))
+		f.Layers = append(f.Layers, layer(c, p))
+	}
+	f.last().add(sum)
+}
+
+// Len returns the number of checksums added to the filter.
+func (f *Filter) Len() int {
+	n := 0
+	for _, l := range f.Layers {
+		n += l.N
+	}
+	return n
+}
+
+// Size returns the memory used by the bits of the filter in bytes.
+func (f *Filter) Size() uint64 {
+	const word = 8
+	var n uint64
+	for _, l := range f.Layers {
+		n += uint64(len(l.Bits)) * word
+	}
+	return n
+}
+
+func (f *Filter) last() *Layer {
+	return &f.Layers[len(f.Layers)-1]
+}
+
+// layer returns an empty Bloom filter with the optimal number of bits
+// and hash functions for the capacity and the false positive rate.
+func layer(capacity int, rate float64) Layer {
+	const word = 64
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	m = (m + word - 1) / word * word
+	k := max(uint64(math.Round(float64(m)/float64(capacity)*math.Ln2)), 1)
+	return Layer{
+		Bits: make([]uint64, m/word),
+		M:    m,
+		K:    k,
+		Cap:  capacity,
+	}
+}
+
+func (l *Layer) has(sum [32]byte) bool {
+	h1, h2 := hashes(sum)
+	for i := range l.K {
+		b := (h1 + i*h2) % l.M
+		if l.Bits[b/64]&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Layer) add(sum [32]byte) {
+	h1, h2 := hashes(sum)
+	for i := range l.K {
+		b := (h1 + i*h2) % l.M
+		l.Bits[b/64] |= 1 << (b % 64)
+	}
+	l.N++
+}
+
+// hashes returns two independent hashes taken from the checksum,
+// which are combined to derive the K hash functions.
+func hashes(sum [32]byte) (uint64, uint64) {
+	return binary.LittleEndian.Uint64(sum[0:8]), binary.LittleEndian.Uint64(sum[8:16]) | 1
+}
@@ -0,0 +1,37 @@
+package bloom_test
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+
+	"github.com/bengarrett/zipcmt/internal/bloom"
+)
+
+func TestFilter(t *testing.T) {
+	const items = 20000
+	f := bloom.New(0.01)
+	for i := range items {
+		f.Add(sha256.Sum256([]byte(strconv.Itoa(i))))
+	}
+	if f.Len() != items {
+		t.Errorf("Filter.Len() = %d, want %d", f.Len(), items)
+	}
+	for i := range items {
+		if !f.Has(sha256.Sum256([]byte(strconv.Itoa(i)))) {
+			t.Fatalf("Filter.Has(%d) = false, want true", i)
+		}
+	}
+	fp := 0
+	for i := items; i < items*2; i++ {
+		if f.Has(sha256.Sum256([]byte(strconv.Itoa(i)))) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / items; rate > 0.02 {
+		t.Errorf("Filter false positive rate = %.4f, want <= 0.02", rate)
+	}
+	if f.Size() == 0 {
+		t.Error("Filter.Size() = 0")
+	}
+}
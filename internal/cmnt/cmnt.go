@@ -1,10 +1,14 @@
 package cmnt
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -78,6 +82,24 @@ func ExportName(path string) string {
 	return strings.TrimSuffix(path, filepath.Ext(path)) + Filename
 }
 
+// Hidden checks that the named file or directory is hidden by a naming convention.
+// These are dot files on POSIX systems and the system directories of Windows drives,
+// such as the recycle bin and System Volume Information.
+func Hidden(name string) bool {
+	name = filepath.Base(name)
+	if name == "." || name == ".." {
+		return false
+	}
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	switch strings.ToLower(name) {
+	case "$recycle.bin", "recycled", "recycler", "system volume information":
+		return true
+	}
+	return false
+}
+
 // Self returns the path for the zipcmt executable.
 func Self() (string, error) {
 	exe, err := os.Executable()
@@ -87,6 +109,54 @@ func Self() (string, error) {
 	return exe, nil
 }
 
+// WriteFile writes the named file using the write func, replacing any existing file.
+// The data is written to a temporary file in the same directory that is renamed once complete,
+// so an interruption never leaves the named file half-written. An existing file keeps its mode,
+// otherwise the new file uses perm.
+func WriteFile(name string, perm fs.FileMode, write func(io.Writer) error) error {
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		return fail(err)
+	}
+	if err := w.Flush(); err != nil {
+		return fail(fmt.Errorf("write: %w", err))
+	}
+	// a temporary file is only readable by its owner
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(fmt.Errorf("chmod: %w", err))
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("close: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// WalkOrder compares the two paths in the lexical order used by filepath.WalkDir.
+// The result is 0 if a == b, negative if a is walked before b, and positive if a is walked after b.
+func WalkOrder(a, b string) int {
+	const sep = string(filepath.Separator)
+	x := strings.Split(filepath.Clean(a), sep)
+	y := strings.Split(filepath.Clean(b), sep)
+	return slices.Compare(x, y)
+}
+
 // Valid checks that the named file is a known zip archive.
 func Valid(name string) bool {
 	const z = ".zip"
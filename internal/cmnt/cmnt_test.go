@@ -1,7 +1,13 @@
 package cmnt_test
 
 import (
+	"errors"
+	"io"
+	"io/fs"
 	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -172,3 +178,93 @@ func TestExport_Unique(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{"equal", "dir/file.zip", "dir/file.zip", 0},
+		{"before", "dir/a.zip", "dir/b.zip", -1},
+		{"after", "dir/b.zip", "dir/a.zip", 1},
+		{"parent", "dir", "dir/a.zip", -1},
+		{"subdir", "dir/sub/z.zip", "dir/sub-a.zip", -1},
+		{"clean", "dir//a.zip", "dir/a.zip", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cmnt.WalkOrder(tt.a, tt.b); got != tt.want {
+				t.Errorf("WalkOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHidden(t *testing.T) {
+	tests := []struct {
+		name  string
+		fname string
+		want  bool
+	}{
+		{"empty", "", false},
+		{"current", ".", false},
+		{"parent", "..", false},
+		{"file", "/somedir/somefile.zip", false},
+		{"dot file", "/somedir/.somefile.zip", true},
+		{"dot dir", "/home/retro/.cache", true},
+		{"trash", "/home/retro/.Trash-1000", true},
+		{"recycle bin", "$RECYCLE.BIN", true},
+		{"system volume", "System Volume Information", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cmnt.Hidden(tt.fname); got != tt.want {
+				t.Errorf("Hidden() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not used by windows")
+	}
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.txt")
+	write := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+	if err := cmnt.WriteFile(name, 0o644, write("first")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("WriteFile() new file mode = %v, %v, want %v", info.Mode().Perm(), err, fs.FileMode(0o644))
+	}
+	// an existing file keeps its mode
+	if err := os.Chmod(name, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmnt.WriteFile(name, 0o644, write("second")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("WriteFile() existing file mode = %v, %v, want %v", info.Mode().Perm(), err, fs.FileMode(0o600))
+	}
+	// a failed write keeps the existing file and removes the temporary file
+	errWrite := errors.New("write failure")
+	err := cmnt.WriteFile(name, 0o644, func(io.Writer) error { return errWrite })
+	if !errors.Is(err, errWrite) {
+		t.Errorf("WriteFile() error = %v, want %v", err, errWrite)
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != "second" {
+		t.Errorf("WriteFile() content = %q, %v, want %q", b, err, "second")
+	}
+	if files, err := os.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("WriteFile() directory has %d files, %v, want 1", len(files), err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package diskset is a set of SHA-256 checksums that is stored in a temporary file,
+// so the memory use stays small and fixed regardless of the number of checksums.
+//
+// The file is an open addressing hash table with linear probing,
+// that is rebuilt with double the number of slots whenever it becomes too full.
+package diskset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	slot  = 32      // slot is the size of a checksum in bytes.
+	slots = 1 << 16 // slots are the initial number of checksums in the table.
+	load  = 0.7     // load is the maximum ratio of used slots before the table is rebuilt.
+	chunk = 1 << 10 // chunk is the number of slots read at once when the table is rebuilt.
+)
+
+// Set of checksums stored in a temporary file.
+type Set struct {
+	dir   string
+	f     *os.File
+	slots uint64
+	n     int
+	zero  bool // zero is true when the all zero checksum is in the set.
+	buf   [slot]byte
+	err   error
+}
+
+// New creates a set using a temporary file in the directory.
+// An empty dir uses the default directory for temporary files.
+func New(dir string) (*Set, error) {
+	s := &Set{dir: dir}
+	f, err := s.create(slots)
+	if err != nil {
+		return nil, err
+	}
+	s.f, s.slots = f, slots
+	return s, nil
+}
+
+// Err returns the first file error, after which the set stops adding checksums.
+func (s *Set) Err() error {
+	return s.err
+}
+
+// Len returns the number of checksums in the set.
+func (s *Set) Len() int {
+	return s.n
+}
+
+// Size returns the size of the temporary file in bytes.
+func (s *Set) Size() uint64 {
+	return s.slots * slot
+}
+
+// Has reports whether the checksum is in the set.
+func (s *Set) Has(sum [32]byte) bool {
+	if sum == [32]byte{} {
+		return s.zero
+	}
+	if s.err != nil {
+		return false
+	}
+	_, ok, err := s.find(s.f, s.slots, sum)
+	if err != nil {
+		s.err = err
+	}
+	return ok
+}
+
+// Add the checksum to the set.
+func (s *Set) Add(sum [32]byte) {
+	if sum == [32]byte{} {
+		if !s.zero {
+			s.zero = true
+			s.n++
+		}
+		return
+	}
+	if s.err != nil {
+		return
+	}
+	i, ok, err := s.find(s.f, s.slots, sum)
+	if err != nil {
+		s.err = err
+		return
+	}
+	if ok {
+		return
+	}
+	if _, err := s.f.WriteAt(sum[:], int64(i*slot)); err != nil { //nolint:gosec
+		s.err = fmt.Errorf("diskset write: %w", err)
+		return
+	}
+	s.n++
+	if float64(s.n) > float64(s.slots)*load {
+		s.err = s.grow()
+	}
+}
+
+// Close and remove the temporary file.
+func (s *Set) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	name := s.f.Name()
+	err := s.f.Close()
+	s.f = nil
+	return errors.Join(err, os.Remove(name))
+}
+
+// create a temporary file that is large enough for the number of slots.
+// The unused space is a sparse file on most file systems.
+func (s *Set) create(n uint64) (*os.File, error) {
+	f, err := os.CreateTemp(s.dir, "zipcmt-hashes-*.bin")
+	if err != nil {
+		return nil, fmt.Errorf("diskset create: %w", err)
+	}
+	if err := f.Truncate(int64(n * slot)); err != nil { //nolint:gosec
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("diskset truncate: %w", err)
+	}
+	return f, nil
+}
+
+// find returns the slot index of the checksum, or the empty slot where it would be stored.
+func (s *Set) find(f *os.File, n uint64, sum [32]byte) (uint64, bool, error) {
+	i := binary.LittleEndian.Uint64(sum[:8]) % n
+	for range n {
+		if _, err := f.ReadAt(s.buf[:], int64(i*slot)); err != nil { //nolint:gosec
+			return 0, false, fmt.Errorf("diskset read: %w", err)
+		}
+		if s.buf == [slot]byte{} {
+			return i, false, nil
+		}
+		if bytes.Equal(s.buf[:], sum[:]) {
+			return i, true, nil
+		}
+		i = (i + 1) % n
+	}
+	return 0, false, io.ErrShortBuffer
+}
+
+// grow rebuilds the table in a new temporary file with double the number of slots.
+func (s *Set) grow() error {
+	n := s.slots * 2
+	f, err := s.create(n)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, chunk*slot)
+	for off := int64(0); off < int64(s.slots*slot); off += int64(len(buf)) { //nolint:gosec
+		r, err := s.f.ReadAt(buf, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			f.Close()
+			os.Remove(f.Name())
+			return fmt.Errorf("diskset grow: %w", err)
+		}
+		for j := 0; j+slot <= r; j += slot {
+			var sum [32]byte
+			copy(sum[:], buf[j:j+slot])
+			if sum == [32]byte{} {
+				continue
+			}
+			i, _, err := s.find(f, n, sum)
+			if err != nil {
+				f.Close()
+				os.Remove(f.Name())
+				return err
+			}
+			if _, err := f.WriteAt(sum[:], int64(i*slot)); err != nil { //nolint:gosec
+				f.Close()
+				os.Remove(f.Name())
+				return fmt.Errorf("diskset grow: %w", err)
+			}
+		}
+	}
+	if err := s.Close(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	s.f, s.slots = f, n
+	return nil
+}
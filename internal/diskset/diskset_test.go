@@ -0,0 +1,43 @@
+package diskset_test
+
+import (
+	"crypto/sha256"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/bengarrett/zipcmt/internal/diskset"
+)
+
+func TestSet(t *testing.T) {
+	const items = 100000 // more than the initial slots to test the growth
+	dir := t.TempDir()
+	s, err := diskset.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range items {
+		s.Add(sha256.Sum256([]byte(strconv.Itoa(i))))
+	}
+	s.Add(sha256.Sum256([]byte("0")))
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != items {
+		t.Errorf("Set.Len() = %d, want %d", s.Len(), items)
+	}
+	for i := range items {
+		if !s.Has(sha256.Sum256([]byte(strconv.Itoa(i)))) {
+			t.Fatalf("Set.Has(%d) = false, want true", i)
+		}
+	}
+	if s.Has(sha256.Sum256([]byte("missing"))) {
+		t.Error("Set.Has(missing) = true, want false")
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Set.Close() left %d files", len(files))
+	}
+}
@@ -0,0 +1,214 @@
+// Package fuzzy normalizes zip comments for hashing and finds
+// near duplicate comments using MinHash signatures of text shingles.
+package fuzzy
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrStep is returned when a normalization step is unknown.
+var ErrStep = errors.New("unknown normalization step, use space, eol, ansi, case, dates, phones or all")
+
+// Norm is a set of normalization steps that are applied to a comment before it is hashed.
+type Norm uint8
+
+const (
+	EOL    Norm = 1 << iota // EOL converts the CRLF and CR line endings to LF.
+	Space                   // Space collapses all runs of whitespace, including line endings, into a single space.
+	ANSI                    // ANSI removes the ANSI escape sequences, such as color codes.
+	Case                    // Case folds the letters to lowercase.
+	Dates                   // Dates replaces any dates with a placeholder.
+	Phones                  // Phones replaces any telephone numbers with a placeholder.
+
+	All = EOL | Space | ANSI | Case | Dates | Phones // All normalization steps.
+)
+
+var (
+	// ansi matches the ESC control, or the CP437 arrow glyph of a decoded ESC, followed by a CSI sequence.
+	ansi = regexp.MustCompile(`(?:\x1b|\x{2190})\[[0-9;?]*[ -/]*[@-~]`)
+	// dates matches numeric dates, such as 1995-12-31, 31/12/95 and 12.31.1995,
+	// and named month dates, such as 31 Dec 1995, Dec 31, 1995 and 31-Dec-95.
+	dates = regexp.MustCompile(`(?i)\b(?:\d{1,4}[-/.]\d{1,2}[-/.]\d{2,4}|` +
+		`(?:\d{1,2}[- ])?(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?[- ]` +
+		`(?:\d{1,2}(?:st|nd|rd|th)?,?[- ])?\d{2,4})\b`)
+	// phones matches telephone numbers, such as (555) 555-1234, +1-555-555-1234 and 555.1234.
+	phones = regexp.MustCompile(`(?:\+?\d{1,3}[-. ])?(?:\(\d{2,4}\) ?|\d{2,4}[-. /])?\d{3}[-. ]\d{4}\b`)
+)
+
+// ParseNorm parses a comma-separated list of normalization steps.
+func ParseNorm(s string) (Norm, error) {
+	var n Norm
+	for step := range strings.SplitSeq(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(step)) {
+		case "":
+		case "eol":
+			n |= EOL
+		case "space", "whitespace":
+			n |= Space
+		case "ansi":
+			n |= ANSI
+		case "case":
+			n |= Case
+		case "date", "dates":
+			n |= Dates
+		case "phone", "phones":
+			n |= Phones
+		case "all":
+			n |= All
+		default:
+			return 0, fmt.Errorf("%w: %q", ErrStep, step)
+		}
+	}
+	return n, nil
+}
+
+// Apply the normalization steps to the comment.
+// The returned comment is always trimmed of any leading and trailing whitespace.
+func (n Norm) Apply(s string) string {
+	if n&ANSI != 0 {
+		s = ansi.ReplaceAllString(s, "")
+	}
+	if n&Dates != 0 {
+		s = dates.ReplaceAllString(s, "<date>")
+	}
+	if n&Phones != 0 {
+		s = phones.ReplaceAllString(s, "<phone>")
+	}
+	if n&Case != 0 {
+		s = strings.ToLower(s)
+	}
+	if n&Space != 0 {
+		s = strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+	} else if n&EOL != 0 {
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+		s = strings.ReplaceAll(s, "\r", "\n")
+	}
+	return strings.TrimSpace(s)
+}
+
+const (
+	shingle = 5            // shingle is the number of runes in each text shingle.
+	rows    = 4            // rows are the number of signature values in each band.
+	bands   = 32           // bands of the signature that are used to find candidates.
+	size    = rows * bands // size is the number of hash functions in a signature.
+	golden  = 0x9e3779b97f4a7c15
+)
+
+// Signature is a MinHash signature of the text shingles of a comment.
+type Signature [size]uint64
+
+// Sign returns the MinHash signature of the comment, which is
+// case folded and stripped of whitespace and ANSI escape codes.
+func Sign(s string) Signature {
+	r := []rune((Space | ANSI | Case).Apply(s))
+	var sig Signature
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	add := func(x uint64) {
+		for i := range sig {
+			if h := mix(x ^ (uint64(i+1) * golden)); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	if len(r) <= shingle {
+		add(hash(string(r)))
+		return sig
+	}
+	for i := 0; i+shingle <= len(r); i++ {
+		add(hash(string(r[i : i+shingle])))
+	}
+	return sig
+}
+
+// Similarity estimates the Jaccard similarity of two signatures, between 0 and 1.
+func (s Signature) Similarity(x Signature) float64 {
+	n := 0
+	for i := range s {
+		if s[i] == x[i] {
+			n++
+		}
+	}
+	return float64(n) / size
+}
+
+// Index of signatures that uses locality-sensitive hashing to find similar comments.
+type Index struct {
+	Threshold float64 // Threshold is the minimum similarity of a match, between 0 and 1.
+
+	names   []string
+	sigs    []Signature
+	buckets map[uint64][]int
+}
+
+// Add the signature and the name of the zip archive to the index.
+func (x *Index) Add(name string, sig Signature) {
+	if x.buckets == nil {
+		x.buckets = make(map[uint64][]int)
+	}
+	id := len(x.sigs)
+	x.names = append(x.names, name)
+	x.sigs = append(x.sigs, sig)
+	for b := range bands {
+		key := band(sig, b)
+		x.buckets[key] = append(x.buckets[key], id)
+	}
+}
+
+// Match returns the name of the zip archive with the most similar signature
+// and its similarity. The ok value is false when no signature meets the Threshold.
+func (x *Index) Match(sig Signature) (string, float64, bool) {
+	best, name := 0.0, ""
+	seen := make(map[int]bool)
+	for b := range bands {
+		for _, id := range x.buckets[band(sig, b)] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if sim := sig.Similarity(x.sigs[id]); sim > best {
+				best, name = sim, x.names[id]
+			}
+		}
+	}
+	if name == "" || best < x.Threshold {
+		return "", best, false
+	}
+	return name, best, true
+}
+
+// Len returns the number of signatures in the index.
+func (x *Index) Len() int {
+	return len(x.sigs)
+}
+
+// band returns the bucket key of the numbered band of the signature.
+func band(sig Signature, b int) uint64 {
+	h := mix(uint64(b+1) * golden)
+	for _, v := range sig[b*rows : (b+1)*rows] {
+		h = mix(h ^ v)
+	}
+	return h
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix is the SplitMix64 finalizer, which is used to derive the independent hash functions.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
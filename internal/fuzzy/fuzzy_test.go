@@ -0,0 +1,84 @@
+package fuzzy_test
+
+import (
+	"testing"
+
+	"github.com/bengarrett/zipcmt/internal/fuzzy"
+)
+
+func TestParseNorm(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    fuzzy.Norm
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"one", "ansi", fuzzy.ANSI, false},
+		{"many", "space, eol,Dates", fuzzy.Space | fuzzy.EOL | fuzzy.Dates, false},
+		{"all", "all", fuzzy.All, false},
+		{"unknown", "space,emoji", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fuzzy.ParseNorm(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseNorm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseNorm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNorm_Apply(t *testing.T) {
+	tests := []struct {
+		name string
+		n    fuzzy.Norm
+		s    string
+		want string
+	}{
+		{"none", 0, "  Call  us\r\n", "Call  us"},
+		{"eol", fuzzy.EOL, "Call\r\nus\rnow", "Call\nus\nnow"},
+		{"space", fuzzy.Space, "Call \t us\r\n now ", "Call us now"},
+		{"ansi", fuzzy.ANSI, "\x1b[1;31mCall\x1b[0m us", "Call us"},
+		{"case", fuzzy.Case, "CALL Us", "call us"},
+		{"dates", fuzzy.Dates, "Uploaded 1995-12-31 and 31 Dec 1995", "Uploaded <date> and <date>"},
+		{"phones", fuzzy.Phones, "Call (555) 555-1234 or +1-555-555-1234", "Call <phone> or <phone>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.n.Apply(tt.s); got != tt.want {
+				t.Errorf("Norm.Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_Match(t *testing.T) {
+	const ad = "The Underground BBS - 24 hours - 14.4k - running since 1993 - sysop The Mole - call now!"
+	x := fuzzy.Index{Threshold: 0.7}
+	x.Add("bbs.zip", fuzzy.Sign(ad))
+	tests := []struct {
+		name   string
+		s      string
+		wantOk bool
+	}{
+		{"identical", ad, true},
+		{"near", "The Underground BBS - 24 hours - 28.8k - running since 1993 - sysop The Mole - call now!", true},
+		{"different", "Greetings from the demo group, this release was cracked in 1994.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, sim, ok := x.Match(fuzzy.Sign(tt.s))
+			if ok != tt.wantOk {
+				t.Errorf("Index.Match() ok = %v (%.2f), want %v", ok, sim, tt.wantOk)
+			}
+			if ok && name != "bbs.zip" {
+				t.Errorf("Index.Match() name = %q, want bbs.zip", name)
+			}
+		})
+	}
+}
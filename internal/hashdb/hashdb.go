@@ -0,0 +1,194 @@
+// Package hashdb is a persistent database of zip comment hashes,
+// which is used to find duplicate comments across multiple scans.
+package hashdb
+
+import (
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+)
+
+// ErrAge is returned when the prune age cannot be parsed.
+var ErrAge = errors.New("age must be a duration such as 72h or 30d, or the word missing")
+
+// Missing is the prune argument that removes the entries of zip archives that no longer exist.
+const Missing = "missing"
+
+type (
+	// Sum is a SHA-256 checksum of a zip comment.
+	Sum = [32]byte
+	// Entry is the first zip archive to use a comment.
+	Entry struct {
+		Path string    // Path of the zip archive that first used the comment.
+		Seen time.Time // Seen is the date and time the comment was first found.
+	}
+	// DB is a database of comment hashes.
+	DB struct {
+		name    string
+		changed bool
+		entries map[Sum]Entry
+	}
+)
+
+// Open reads the named database file.
+// A new empty database is returned if the file does not exist.
+func Open(name string) (*DB, error) {
+	db := &DB{
+		name:    name,
+		entries: make(map[Sum]Entry),
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hashdb open: %w", err)
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&db.entries); err != nil {
+		return nil, fmt.Errorf("hashdb decode %s: %w", name, err)
+	}
+	return db, nil
+}
+
+// Name returns the file path of the database.
+func (db *DB) Name() string {
+	return db.name
+}
+
+// Len returns the number of comment hashes in the database.
+func (db *DB) Len() int {
+	return len(db.entries)
+}
+
+// Has reports whether the comment hash is in the database.
+func (db *DB) Has(sum Sum) bool {
+	_, ok := db.entries[sum]
+	return ok
+}
+
+// Sums calls fn for every comment hash in the database.
+func (db *DB) Sums(fn func(Sum)) {
+	for sum := range db.entries {
+		fn(sum)
+	}
+}
+
+// Add the comment hash with the path of the zip archive and the time it was found.
+// Existing hashes are not replaced and Add returns false.
+func (db *DB) Add(sum Sum, path string, seen time.Time) bool {
+	if db.Has(sum) {
+		return false
+	}
+	db.entries[sum] = Entry{Path: path, Seen: seen}
+	db.changed = true
+	return true
+}
+
+// Prune removes the entries that keep returns false for and returns the number of removals.
+func (db *DB) Prune(keep func(Entry) bool) int {
+	n := 0
+	for sum, e := range db.entries {
+		if keep(e) {
+			continue
+		}
+		delete(db.entries, sum)
+		n++
+	}
+	if n > 0 {
+		db.changed = true
+	}
+	return n
+}
+
+// Save writes any changes to the database file.
+func (db *DB) Save() error {
+	if !db.changed {
+		return nil
+	}
+	const perm = 0o644
+	if err := cmnt.WriteFile(db.name, perm, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(db.entries)
+	}); err != nil {
+		return fmt.Errorf("hashdb %w", err)
+	}
+	db.changed = false
+	return nil
+}
+
+// List writes the entries sorted by the date they were first seen.
+func (db *DB) List(w io.Writer) error {
+	type row struct {
+		sum Sum
+		Entry
+	}
+	rows := make([]row, 0, len(db.entries))
+	for sum, e := range db.entries {
+		rows = append(rows, row{sum, e})
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		if n := a.Seen.Compare(b.Seen); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	const padding = 2
+	tw := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+	for _, r := range rows {
+		const short = 6
+		fmt.Fprintf(tw, "%s\t%s\t%s\n",
+			r.Seen.Format(time.DateTime), hex.EncodeToString(r.sum[:short]), r.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("hashdb list: %w", err)
+	}
+	return nil
+}
+
+// Keep returns a prune func for the age argument.
+// The age is either a duration, such as 72h or 30d, where any entries first seen before
+// the duration are removed, or Missing to remove the entries of zip archives that no longer exist.
+func Keep(age string, now time.Time) (func(Entry) bool, error) {
+	if strings.EqualFold(age, Missing) {
+		return func(e Entry) bool {
+			_, err := os.Stat(e.Path)
+			return !errors.Is(err, fs.ErrNotExist)
+		}, nil
+	}
+	d, err := ParseAge(age)
+	if err != nil {
+		return nil, err
+	}
+	since := now.Add(-d)
+	return func(e Entry) bool {
+		return !e.Seen.Before(since)
+	}, nil
+}
+
+// ParseAge parses a duration string that also supports a d suffix for days.
+func ParseAge(s string) (time.Duration, error) {
+	const day = 24 * time.Hour
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%w: %q", ErrAge, s)
+		}
+		return time.Duration(n) * day, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrAge, s)
+	}
+	return d, nil
+}
@@ -0,0 +1,80 @@
+package hashdb_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/hashdb"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"empty", "", 0, true},
+		{"hours", "72h", 72 * time.Hour, false},
+		{"days", "30d", 30 * 24 * time.Hour, false},
+		{"negative", "-1d", 0, true},
+		{"invalid", "1w", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hashdb.ParseAge(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hashes.gob")
+	db, err := hashdb.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if !db.Add(hashdb.Sum{1}, "/old.zip", now.AddDate(0, 0, -60)) {
+		t.Error("DB.Add() = false, want true")
+	}
+	if !db.Add(hashdb.Sum{2}, "/new.zip", now) {
+		t.Error("DB.Add() = false, want true")
+	}
+	if db.Add(hashdb.Sum{2}, "/dupe.zip", now) {
+		t.Error("DB.Add() duplicate = true, want false")
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = hashdb.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 2 || !db.Has(hashdb.Sum{1}) {
+		t.Errorf("Open() len = %d, want 2", db.Len())
+	}
+	sb := strings.Builder{}
+	if err := db.List(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(sb.String()), "\n"); len(lines) != 2 ||
+		!strings.HasSuffix(lines[0], "/old.zip") {
+		t.Errorf("DB.List() = %q", sb.String())
+	}
+	keep, err := hashdb.Keep("30d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Prune(keep); n != 1 || db.Has(hashdb.Sum{1}) {
+		t.Errorf("DB.Prune() = %d, want 1", n)
+	}
+}
@@ -0,0 +1,304 @@
+// Package zipedit rewrites the archive comment and the entry comments of a zip file
+// without recompressing or otherwise changing any of its file entries.
+package zipedit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrEOCD is returned when the file is not a zip archive.
+	ErrEOCD = errors.New("end of central directory record cannot be found, it is not a zip archive")
+	// ErrLength is returned when the comment is too long.
+	ErrLength = errors.New("comment is longer than the 65,535 bytes allowed by a zip archive")
+	// ErrDirectory is returned when the central directory is damaged.
+	ErrDirectory = errors.New("central directory is invalid")
+)
+
+const (
+	eocdSig    = 0x06054b50 // eocdSig is the signature of the end of central directory record.
+	eocdLen    = 22         // eocdLen is the length of the record without the comment.
+	commentPos = 20         // commentPos is the offset of the comment length in the record.
+	dirSizePos = 12         // dirSizePos is the offset of the central directory size in the record.
+	dirPos     = 16         // dirPos is the offset of the central directory offset in the record.
+	headerSig  = 0x02014b50 // headerSig is the signature of a central directory file header.
+	headerLen  = 46         // headerLen is the length of a file header without the name, extra field and comment.
+	locatorSig = 0x07064b50 // locatorSig is the signature of the zip64 end of central directory locator.
+	locatorLen = 20         // locatorLen is the length of the zip64 locator.
+	zip64Sig   = 0x06064b50 // zip64Sig is the signature of the zip64 end of central directory record.
+	zip64Len   = 56         // zip64Len is the length of the zip64 record without the extensible data.
+	// MaxComment is the maximum length in bytes of a zip archive comment.
+	MaxComment = 0xffff
+)
+
+// Options of Write.
+type Options struct {
+	// Backup is an optional filename to keep a copy of the original archive.
+	// Any existing file of the same name is replaced.
+	Backup string
+	// Keep the modification time of the original archive.
+	Keep bool
+	// Entries removes the comments of the file entries in the central directory.
+	Entries bool
+}
+
+// eocd is the location of the end of central directory record.
+type eocd struct {
+	pos int64 // pos is the offset of the record.
+}
+
+// Read returns the archive comment of the named zip file in its original encoding.
+func Read(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("zipedit read: %w", err)
+	}
+	defer f.Close()
+	_, cmmt, err := find(f)
+	return cmmt, err
+}
+
+// find returns the location of the end of central directory record and the archive comment.
+// The record is searched backwards from the end of the file, as the comment
+// could also contain the record signature.
+func find(f *os.File) (eocd, []byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return eocd{}, nil, fmt.Errorf("zipedit stat: %w", err)
+	}
+	size := info.Size()
+	n := min(size, eocdLen+MaxComment)
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, size-n); err != nil && !errors.Is(err, io.EOF) {
+		return eocd{}, nil, fmt.Errorf("zipedit read: %w", err)
+	}
+	sig := binary.LittleEndian.AppendUint32(nil, eocdSig)
+	for i := len(tail) - eocdLen; i >= 0; i-- {
+		if !bytes.Equal(tail[i:i+4], sig) {
+			continue
+		}
+		l := int(binary.LittleEndian.Uint16(tail[i+commentPos:]))
+		if i+eocdLen+l != len(tail) {
+			continue
+		}
+		cmmt := bytes.Clone(tail[i+eocdLen:])
+		return eocd{pos: size - n + int64(i)}, cmmt, nil
+	}
+	return eocd{}, nil, ErrEOCD
+}
+
+// Write replaces the archive comment of the named zip file with cmmt.
+// Only the end of central directory record is rewritten, and the central directory when
+// the Entries option removes the entry comments, the entries are copied as-is.
+// The archive is replaced atomically using a temporary file in the same directory.
+func Write(name string, cmmt []byte, opt Options) error {
+	if len(cmmt) > MaxComment {
+		return ErrLength
+	}
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("zipedit open: %w", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("zipedit stat: %w", err)
+	}
+	end, _, err := find(src)
+	if err != nil {
+		return err
+	}
+	start, dir := end.pos+commentPos, []byte(nil)
+	if opt.Entries {
+		if start, dir, err = central(src, end); err != nil {
+			return err
+		}
+	}
+	return replace(name, info, opt, func(w io.Writer) error {
+		// the entries, and the central directory and the record up to the comment length
+		// when they are not rewritten
+		if _, err := io.Copy(w, io.NewSectionReader(src, 0, start)); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if _, err := w.Write(dir); err != nil {
+			return err //nolint:wrapcheck
+		}
+		return writeComment(w, cmmt)
+	})
+}
+
+// central returns the offset of the central directory and a copy of it without the
+// entry comments, followed by the end of central directory records up to the comment length.
+// The directory sizes of the records, and the offset of any zip64 record, are updated.
+func central(f *os.File, end eocd) (int64, []byte, error) {
+	le := binary.LittleEndian
+	rec := make([]byte, eocdLen)
+	if _, err := f.ReadAt(rec, end.pos); err != nil {
+		return 0, nil, fmt.Errorf("zipedit read: %w", err)
+	}
+	size, offset := int64(le.Uint32(rec[dirSizePos:])), int64(le.Uint32(rec[dirPos:]))
+	limit, z64 := end.pos, int64(-1)
+	if end.pos >= locatorLen {
+		loc := make([]byte, locatorLen)
+		if _, err := f.ReadAt(loc, end.pos-locatorLen); err != nil {
+			return 0, nil, fmt.Errorf("zipedit read: %w", err)
+		}
+		if le.Uint32(loc) == locatorSig {
+			z64 = int64(le.Uint64(loc[8:])) //nolint:gosec
+			r := make([]byte, zip64Len)
+			if z64+zip64Len > end.pos-locatorLen {
+				return 0, nil, ErrDirectory
+			}
+			if _, err := f.ReadAt(r, z64); err != nil || le.Uint32(r) != zip64Sig {
+				return 0, nil, ErrDirectory
+			}
+			size, offset = int64(le.Uint64(r[40:])), int64(le.Uint64(r[48:])) //nolint:gosec
+			limit = z64
+		}
+	}
+	// self-extracting archives have data before the entries that the offset excludes
+	start := offset
+	sig := make([]byte, 4)
+	if _, err := f.ReadAt(sig, start); err != nil || le.Uint32(sig) != headerSig {
+		start = limit - size
+	}
+	if start < 0 || size < 0 || start+size > limit {
+		return 0, nil, ErrDirectory
+	}
+	b := make([]byte, end.pos+commentPos-start)
+	if _, err := f.ReadAt(b, start); err != nil {
+		return 0, nil, fmt.Errorf("zipedit read: %w", err)
+	}
+	dir := make([]byte, 0, len(b))
+	for p := int64(0); p < size; {
+		if p+headerLen > size || le.Uint32(b[p:]) != headerSig {
+			return 0, nil, ErrDirectory
+		}
+		h := b[p:]
+		l := int64(headerLen) + int64(le.Uint16(h[28:])) + int64(le.Uint16(h[30:]))
+		n := l + int64(le.Uint16(h[32:]))
+		if p+n > size {
+			return 0, nil, ErrDirectory
+		}
+		dir = append(dir, h[:l]...)
+		le.PutUint16(dir[len(dir)-int(l)+32:], 0)
+		p += n
+	}
+	shrunk := size - int64(len(dir))
+	tail := bytes.Clone(b[size:])
+	if z64 >= 0 {
+		le.PutUint64(tail[z64-start-size+40:], uint64(len(dir)))
+		le.PutUint64(tail[end.pos-locatorLen-start-size+8:], uint64(z64-shrunk)) //nolint:gosec
+	}
+	if r := tail[end.pos-start-size:]; le.Uint32(r[dirSizePos:]) != 0xffffffff {
+		le.PutUint32(r[dirSizePos:], uint32(len(dir))) //nolint:gosec
+	}
+	return start, append(dir, tail...), nil
+}
+
+func writeComment(w io.Writer, cmmt []byte) error {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(len(cmmt))) //nolint:gosec
+	if _, err := w.Write(append(b, cmmt...)); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return nil
+}
+
+// replace writes a temporary copy of the named archive using the write func,
+// and then renames it over the original, after an optional backup.
+func replace(name string, info os.FileInfo, opt Options, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("zipedit create: %w", err)
+	}
+	undo := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if err := write(tmp); err != nil {
+		undo()
+		return fmt.Errorf("zipedit write: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		undo()
+		return fmt.Errorf("zipedit chmod: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("zipedit close: %w", err)
+	}
+	if opt.Keep {
+		if err := os.Chtimes(tmp.Name(), time.Now(), info.ModTime()); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("zipedit chtimes: %w", err)
+		}
+	}
+	if opt.Backup != "" {
+		if err := backup(name, opt.Backup, info); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("zipedit rename: %w", err)
+	}
+	return nil
+}
+
+// backup copies the named file to dst, which keeps the modification time.
+// A hard link is used when the file system supports it. The copy is written to
+// a temporary file that atomically replaces any existing dst.
+func backup(name, dst string, info os.FileInfo) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*")
+	if err != nil {
+		return fmt.Errorf("zipedit backup: %w", err)
+	}
+	if err := copyFile(name, tmp, info); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("zipedit backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("zipedit backup: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies the named file to the empty and open tmp file, which is closed.
+// The tmp file is replaced by a hard link to the named file when it is supported.
+func copyFile(name string, tmp *os.File, info os.FileInfo) error {
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Link(name, tmp.Name()); err == nil {
+		return nil
+	}
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(f.Name(), time.Now(), info.ModTime())
+}
@@ -0,0 +1,220 @@
+package zipedit_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/zipedit"
+)
+
+func create(t *testing.T, name, comment string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, s := range []string{"a.txt", "b.txt"} {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: s, Method: zip.Deflate, Comment: "entry " + s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(strings.Repeat(s, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verify checks the archive comment and that the entries are unchanged.
+func verify(t *testing.T, name, comment string) *zip.ReadCloser {
+	t.Helper()
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	if r.Comment != comment {
+		t.Errorf("comment = %q, want %q", r.Comment, comment)
+	}
+	if len(r.File) != 2 {
+		t.Fatalf("entries = %d, want 2", len(r.File))
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Repeat(f.Name, 100); string(b) != want {
+			t.Errorf("entry %s has changed", f.Name)
+		}
+	}
+	return r
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		cmmt    string
+		wantErr error
+	}{
+		{"set", "", "BBS advert", nil},
+		{"replace", "BBS advert", "\xb0\xb1\xb2 new advert", nil},
+		{"clear", "BBS advert", "", nil},
+		{"signature", "PK\x05\x06 in the comment", "replaced", nil},
+		{"too long", "", strings.Repeat("x", zipedit.MaxComment+1), zipedit.ErrLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test.zip")
+			create(t, name, tt.old)
+			err := zipedit.Write(name, []byte(tt.cmmt), zipedit.Options{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				verify(t, name, tt.old)
+				return
+			}
+			verify(t, name, tt.cmmt)
+			b, err := zipedit.Read(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, []byte(tt.cmmt)) {
+				t.Errorf("Read() = %q, want %q", b, tt.cmmt)
+			}
+		})
+	}
+}
+
+func TestWrite_options(t *testing.T) {
+	dir := t.TempDir()
+	name, bak := filepath.Join(dir, "test.zip"), filepath.Join(dir, "test.zip.bak")
+	create(t, name, "original")
+	old := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := zipedit.Write(name, []byte("new"), zipedit.Options{Backup: bak, Keep: true}); err != nil {
+		t.Fatal(err)
+	}
+	verify(t, name, "new")
+	verify(t, bak, "original")
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("Write() mod time = %s, want %s", info.ModTime(), old)
+	}
+	// a second write replaces the backup
+	if err := zipedit.Write(name, []byte("newer"), zipedit.Options{Backup: bak}); err != nil {
+		t.Fatal(err)
+	}
+	verify(t, name, "newer")
+	verify(t, bak, "new")
+	if _, err := zipedit.Read(filepath.Join("..", "..", "go.mod")); !errors.Is(err, zipedit.ErrEOCD) {
+		t.Errorf("Read() error = %v, want %v", err, zipedit.ErrEOCD)
+	}
+}
+
+func TestWrite_entries(t *testing.T) {
+	many := func(t *testing.T, name string) {
+		t.Helper()
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		// more than 65,535 entries need the zip64 records
+		w := zip.NewWriter(f)
+		for i := range 0x10000 {
+			h := &zip.FileHeader{Name: strconv.Itoa(i), Method: zip.Store, Comment: "entry"}
+			if _, err := w.CreateHeader(h); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.SetComment("BBS advert"); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sfx := func(t *testing.T, name string) {
+		t.Helper()
+		create(t, name, "BBS advert")
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a self-extracting stub that is not included by the central directory offset
+		b = append([]byte("MZ stub"+strings.Repeat("\x00", 100)), b...)
+		if err := os.WriteFile(name, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		create func(*testing.T, string)
+		want   int
+	}{
+		{"entries", func(t *testing.T, name string) { create(t, name, "BBS advert") }, 2},
+		{"self-extracting", sfx, 2},
+		{"zip64", many, 0x10000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test.zip")
+			tt.create(t, name)
+			if err := zipedit.Write(name, nil, zipedit.Options{Entries: true}); err != nil {
+				t.Fatal(err)
+			}
+			r, err := zip.OpenReader(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Comment != "" {
+				t.Errorf("comment = %q, want none", r.Comment)
+			}
+			if len(r.File) != tt.want {
+				t.Fatalf("entries = %d, want %d", len(r.File), tt.want)
+			}
+			for _, f := range r.File {
+				if f.Comment != "" {
+					t.Fatalf("entry %s comment = %q, want none", f.Name, f.Comment)
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, rc); err != nil {
+					t.Errorf("entry %s: %s", f.Name, err)
+				}
+				rc.Close()
+			}
+		})
+	}
+}
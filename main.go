@@ -4,17 +4,23 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"runtime"
 	"slices"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/bengarrett/zipcmt/internal/hashdb"
 	zipcmt "github.com/bengarrett/zipcmt/pkg"
 	"github.com/gookit/color"
 )
@@ -30,15 +36,31 @@ var (
 
 const winOS = "windows"
 
+var errHashDB = errors.New("the -hashdb option with a file path is required")
+
+// stderrColor is true when the output to the standard error may use colour.
+var stderrColor bool
+
 func main() {
 	const ellipsis = "\u2026"
 	var configs zipcmt.Config
-	var noprint bool
+	var noprint, nocache, watch bool
+	var mode string
 	configs.SetTimer()
+	// the automatic colour mode is used by any help shown while parsing the flags
+	_ = setColor("auto")
+	flag.StringVar(&mode, "color", "auto",
+		"use colour in the output, either auto, always or never, auto follows the NO_COLOR and FORCE_COLOR variables")
 	flag.BoolVar(&noprint, "noprint", false,
 		"do not print comments to the terminal to improve the performance of the scan")
 	flag.BoolVar(&configs.NoWalk, "norecursive", false,
 		"do not recursively walk through any subdirectories while scanning for zip archives")
+	flag.BoolVar(&configs.OneFileSystem, "xdev", false,
+		"do not walk into any subdirectories that are mount points of other devices or file systems")
+	flag.BoolVar(&configs.Count, "count", false,
+		"count the zip archives before the scan to show a progress bar and the time remaining")
+	flag.BoolVar(&configs.Hidden, "hidden", false,
+		"include hidden files and directories, such as dot files and the recycle bin")
 	flag.BoolVar(&configs.Export, "export", false,
 		fmt.Sprintf("save comments to the directories that contain the zip files (%s)",
 			color.Danger.Sprint("not advised")))
@@ -56,6 +78,84 @@ func main() {
 		"use the original comment text encoding (CP437, ISO-8859"+ellipsis+") instead of Unicode")
 	flag.StringVar(&configs.SaveName, "save", "",
 		"save the comments to this directory as unique named text files")
+	flag.BoolVar(&watch, "watch", false,
+		"after the scan, continue to watch the directories for new zip archives until interrupted")
+	flag.BoolVar(&configs.Cold, "cold", false,
+		"ignore the cache of previously scanned zip archives and read every comment")
+	flag.BoolVar(&nocache, "nocache", false,
+		"do not read or write the cache of scanned zip archives, which is also unused by the disk and bloom -dedup stores")
+	flag.StringVar(&configs.Format, "format", "text",
+		"the output format of the scan results, either text, json, ndjson to stream a json line per comment, csv or tsv")
+	flag.BoolVar(&configs.List, "list", false,
+		"only print the paths of the zip archives with a comment, one per line")
+	flag.BoolVar(&configs.ListEmpty, "list-empty", false,
+		"only print the paths of the zip archives without a comment")
+	flag.BoolVar(&configs.Print0, "print0", false,
+		"separate the -list and -list-empty paths with a NUL character, for use with xargs -0")
+	flag.StringVar(&configs.Template, "template", "",
+		"render each comment using this Go text/template file or inline template, such as '{{.Path}} {{.Size | humanize}}'")
+	flag.StringVar(&configs.Header, "header", "",
+		"a template file or inline template rendered before the -template results")
+	flag.StringVar(&configs.Footer, "footer", "",
+		"a template file or inline template rendered after the -template results, with the scan totals")
+	flag.BoolVar(&configs.Text, "text", false,
+		"include the comment text as the last column of the csv and tsv formats")
+	flag.StringVar(&configs.Sort, "sort", "",
+		"sort the comments of all the directories after the scan by path, mtime, size, length or count")
+	flag.BoolVar(&configs.Reverse, "reverse", false,
+		"reverse the -sort order, to show the newest, largest, longest or most used comments first")
+	flag.IntVar(&configs.Limit, "limit", 0,
+		"only print and save this number of comments, such as -sort=mtime -reverse -limit=50 for the 50 newest")
+	flag.StringVar(&configs.Paths, "paths", "",
+		"show the archive paths as relative to each directory, absolute, or home with a ~ for the home directory")
+	flag.StringVar(&configs.Base, "base", "",
+		"show the archive paths relative to this directory instead of each scanned directory")
+	flag.StringVar(&configs.Keep, "keep", "first",
+		"the archive that owns a duplicate comment, either first, oldest, newest, shortest-path or largest")
+	flag.BoolVar(&configs.Report, "report", false,
+		"after the scan, list each unique comment with every archive that uses it, sorted by the most used")
+	flag.StringVar(&configs.Normalize, "normalize", "",
+		"normalize comments before finding duplicates, a list of: eol, space, ansi, case, dates, phones or all")
+	flag.Float64Var(&configs.Similar, "similar", 0,
+		"report comments as near duplicates when their similarity is at least this threshold, such as 0.8")
+	flag.StringVar(&configs.Dedup, "dedup", "memory",
+		"store the hashes of unique comments in memory, or use disk or bloom to limit the memory use of large scans")
+	flag.Float64Var(&configs.FalsePositive, "fpr", 0.001,
+		"the false positive rate of the bloom dedup store, which ignores some unique comments as duplicates")
+	flag.StringVar(&configs.HashDB, "hashdb", "",
+		"keep the hashes of found comments in this file, to only show new comments in later scans")
+	hashList := flag.Bool("hashdb-list", false,
+		"list the comment hashes in the -hashdb file with the first archive and date they were seen")
+	hashPrune := flag.String("hashdb-prune", "",
+		"remove the comment hashes in the -hashdb file first seen before an age (72h, 30d) or whose archive is missing")
+	flag.StringVar(&configs.Bundle, "bundle", "",
+		"write every found comment into this single text file, each with a header of its path and date")
+	flag.BoolVar(&configs.TOC, "toc", false,
+		"add a table of contents to the start of the -bundle file")
+	flag.StringVar(&configs.HTML, "html", "",
+		"write a static website of the comments to this directory, which can be browsed without a server")
+	flag.StringVar(&configs.DB, "db", "",
+		"catalogue every scanned archive and comment in this SQLite database, with a full-text search index")
+	flag.StringVar(&configs.Write, "write", "",
+		"write the -comment to every archive instead of reading it, using set, append or prepend")
+	flag.StringVar(&configs.Comment, "comment", "",
+		"the comment text used by -write, or a text file when prefixed with @")
+	flag.BoolVar(&configs.Encode, "cp437", false,
+		"encode the -comment text as CP437 before it is written")
+	flag.BoolVar(&configs.Backup, "backup", false,
+		"keep a copy of every archive rewritten by -write with a .bak extension")
+	flag.BoolVar(&configs.Strip, "strip", false,
+		"remove the comment of every archive instead of reading it, keeping the modification times")
+	flag.StringVar(&configs.Match, "match", "",
+		"only -strip the archive comments that match this regular expression")
+	flag.StringVar(&configs.Hashes, "hashes", "",
+		"only -strip the archive comments with a SHA-256 checksum listed in this file, such as a csv from a previous scan")
+	flag.BoolVar(&configs.Entries, "entries", false,
+		"-strip the comments of the file entries within the archives")
+	flag.BoolVar(&configs.DryRun, "dry-run", false,
+		"list the archives that -strip or -write would change without rewriting them")
+	flag.StringVar(&configs.Checkpoint, "checkpoint", "",
+		"periodically save the scan progress to this file, to resume an interrupted scan")
 	ver := flag.Bool("version", false,
 		"version and information for this program")
 	aliasA := flag.Bool("a", false, "alias for all")
@@ -69,6 +169,19 @@ func main() {
 		help(os.Stderr, true)
 	}
 	flag.Parse()
+	if err := setColor(mode); err != nil {
+		restore := stderr()
+		fmt.Fprintln(os.Stderr, color.Error.Sprint(err))
+		restore()
+	}
+	if *hashList || *hashPrune != "" {
+		if err := hashes(os.Stdout, configs.HashDB, *hashList, *hashPrune); err != nil {
+			stderr()
+			fmt.Fprintln(os.Stderr, color.Error.Sprint(err))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	flags(ver, aliasV, aliasQ)
 	// parse aliases
 	if *aliasR {
@@ -91,13 +204,37 @@ func main() {
 	if *aliasA {
 		configs.Dupes = true
 	}
+	// cache the comments of unchanged archives between scans,
+	// except when the memory use is limited, as the cache is held in memory
+	configs.Cache = !nocache && (configs.Dedup == "" || strings.EqualFold(configs.Dedup, "memory"))
 	// directories to scan
 	configs.Dirs = flag.Args()
+	// reject any invalid option values before the scan
+	if err := configs.Validate(); err != nil {
+		configs.Error(err)
+		os.Exit(1)
+	}
+	// stop the scan on an interrupt but still print the summaries,
+	// a second interrupt exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 	// file and directory scan
-	configs.WalkDirs()
+	if watch {
+		if err := configs.Watch(ctx); err != nil {
+			configs.Error(err)
+		}
+	} else {
+		configs.WalkDirsContext(ctx)
+	}
 	// summaries
-	fmt.Fprintln(os.Stdout, configs.Status())
-	if s := configs.LogName(); s != "" {
+	if err := configs.Summary(os.Stdout); err != nil {
+		configs.Error(err)
+	}
+	if s := configs.LogName(); s != "" && !configs.Machine() {
 		fmt.Fprintf(os.Stdout, "%s %s\n", "The log is found at", color.Primary.Sprint(s))
 	}
 }
@@ -127,12 +264,69 @@ func flags(ver, aliasV, quiet *bool) {
 		if runtime.GOOS == winOS {
 			s = "zipcmt requires at least one directory or drive letter to scan"
 		}
+		restore := stderr()
 		fmt.Fprintln(w, color.Warn.Sprint(s)+"\n")
+		restore()
 		help(w, false)
 		os.Exit(0)
 	}
 }
 
+// setColor sets the colour rendering of the standard output and the standard error
+// using the colour mode and the environment. Each stream is checked for a terminal.
+func setColor(mode string) error {
+	out, err := zipcmt.UseColor(mode, zipcmt.Terminal(os.Stdout), os.Getenv)
+	if err != nil {
+		mode = "auto"
+		out, _ = zipcmt.UseColor(mode, zipcmt.Terminal(os.Stdout), os.Getenv)
+	}
+	stderrColor, _ = zipcmt.UseColor(mode, zipcmt.Terminal(os.Stderr), os.Getenv)
+	color.Enable = out
+	if (out || stderrColor) && !color.SupportColor() {
+		// the terminal detection of the color package is overruled by an always mode or FORCE_COLOR
+		color.ForceOpenColor()
+	}
+	return err //nolint:wrapcheck
+}
+
+// stderr sets the colour rendering for output to the standard error,
+// and returns a func to restore the colour rendering of the standard output.
+func stderr() func() {
+	enable := color.Enable
+	color.Enable = stderrColor
+	return func() {
+		color.Enable = enable
+	}
+}
+
+// Hashes lists or prunes the entries of the named comment hash database.
+func hashes(w io.Writer, name string, list bool, prune string) error {
+	if name == "" {
+		return errHashDB
+	}
+	db, err := hashdb.Open(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if prune != "" {
+		keep, err := hashdb.Keep(prune, time.Now())
+		if err != nil {
+			return fmt.Errorf("hashdb prune: %w", err)
+		}
+		n := db.Prune(keep)
+		if err := db.Save(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(w, "Pruned %d comment hashes, %d remain\n", n, db.Len())
+	}
+	if list {
+		if err := db.List(w); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func helpPosix(w io.Writer) {
 	const ps = string(os.PathSeparator)
 	fmt.Fprintln(w, "    zipcmt [options] <directories>")
@@ -178,6 +372,9 @@ func helpWin(w io.Writer) {
 
 // Help, usage and examples.
 func help(w io.Writer, logo bool) {
+	if w == os.Stderr {
+		defer stderr()()
+	}
 	var f *flag.Flag
 	if logo {
 		fmt.Fprintln(w, brand)
@@ -201,7 +398,12 @@ func help(w io.Writer, logo bool) {
 	const padding = 4
 	tw := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
 	names := []string{
-		"save", "overwrite", "noprint", "norecursive", "all", "now", "raw", "export", "quiet", "version",
+		"save", "overwrite", "noprint", "norecursive", "xdev", "hidden", "count",
+		"all", "color", "list", "format", "text", "template", "sort", "limit",
+		"paths", "keep", "report", "normalize", "similar", "dedup", "now", "raw",
+		"export", "checkpoint", "cold", "nocache", "watch", "hashdb", "db", "html", "bundle",
+		"write", "comment", "cp437", "backup", "strip", "match", "hashes", "entries",
+		"dry-run", "quiet", "version",
 	}
 	for name := range slices.Values(names) {
 		f = flag.Lookup(name)
@@ -214,7 +416,7 @@ func help(w io.Writer, logo bool) {
 	tw.Flush()
 }
 
-func helper(tw *tabwriter.Writer, f *flag.Flag, name string) {
+func helper(tw *tabwriter.Writer, f *flag.Flag, name string) { //nolint:cyclop
 	if tw == nil || f == nil {
 		return
 	}
@@ -227,14 +429,83 @@ func helper(tw *tabwriter.Writer, f *flag.Flag, name string) {
 		fmt.Fprintf(tw, "    -p, -%v\t%v\n", "noprint", "suppress comment output (faster for large scans)")
 	case "norecursive":
 		fmt.Fprintf(tw, "    -%v, -%v\t%v\n", "r", "norecursive", "no subdirectory traversal")
+	case "xdev":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "xdev", "stay on the file system of each directory")
+	case "hidden":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "hidden", "include hidden files and directories")
+	case "count":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "count", "pre-count archives for a progress bar")
 	case "all":
 		fmt.Fprintf(tw, "    -%v, -%v\t%v\n", "a", "all", "show all duplicates")
+	case "format":
+		fmt.Fprintf(tw, "    -%v=FORMAT\t%v\n", "format", "text, json, ndjson, csv or tsv")
+	case "text":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "text", "include the comments in the csv or tsv tables")
+	case "color":
+		fmt.Fprintf(tw, "    -%v=WHEN\t%v\n", "color", "auto, always or never, see also NO_COLOR and FORCE_COLOR")
+	case "list":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "list", "only print the paths of archives with comments, see also -list-empty and -print0")
+	case "template":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "template", "render the comments with a Go template, see also -header and -footer")
+	case "sort":
+		fmt.Fprintf(tw, "    -%v=ORDER\t%v\n", "sort", "path, mtime, size, length or count, see also -reverse")
+	case "limit":
+		fmt.Fprintf(tw, "    -%v=N\t%v\n", "limit", "only print and save N comments")
+	case "paths":
+		fmt.Fprintf(tw, "    -%v=STYLE\t%v\n", "paths", "relative, absolute or home, see also -base")
+	case "keep":
+		fmt.Fprintf(tw, "    -%v=POLICY\t%v\n", "keep", "first, oldest, newest, shortest-path or largest")
+	case "bundle":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "bundle", "write the comments into one text file, use -toc for a table of contents")
+	case "html":
+		fmt.Fprintf(tw, "    -%v=DIR\t%v\n", "html", "write a static website of the comments")
+	case "db":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "db", "catalogue the archives and comments in a SQLite database")
+	case "write":
+		fmt.Fprintf(tw, "    -%v=MODE\t%v\n", "write", "set, append or prepend the -comment to the archives")
+	case "comment":
+		fmt.Fprintf(tw, "    -%v=TEXT\t%v\n", "comment", "comment text for -write, or @FILE to read a file")
+	case "cp437":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "cp437", "encode the -comment as CP437")
+	case "backup":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "backup", "keep a .bak copy of each rewritten archive")
+	case "strip":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "strip", "remove the archive comments, keeping the modification times")
+	case "match":
+		fmt.Fprintf(tw, "    -%v=REGEXP\t%v\n", "match", "only -strip the comments that match the expression")
+	case "hashes":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "hashes", "only -strip the comments with a listed SHA-256 checksum")
+	case "entries":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "entries", "also -strip the comments of the file entries")
+	case "dry-run":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "dry-run", "list the archives that -strip or -write would change")
+	case "report":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "report", "group the archives by their comments")
+	case "normalize":
+		fmt.Fprintf(tw, "    -%v=STEPS\t%v\n", "normalize", "ignore eol,space,ansi,case,dates,phones in dupes")
+	case "similar":
+		fmt.Fprintf(tw, "    -%v=0.8\t%v\n", "similar", "hide near duplicates above this similarity")
+	case "dedup":
+		fmt.Fprintf(tw, "    -%v=STORE\t%v\n", "dedup", "memory, disk or bloom, for huge scans")
+		fmt.Fprintf(tw, "    -%v=RATE\t%v\n", "fpr", "false positive rate of bloom (0.001)")
 	case "now":
 		fmt.Fprintf(tw, "    -%v\t%v\n", "now", "don't preserve dates")
 	case "raw":
 		fmt.Fprintf(tw, "    -%v\t%v\n", "raw", "use original encoding")
 	case "export":
 		fmt.Fprintf(tw, "    -%v\t%v\n", "export", "save alongside files")
+	case "checkpoint":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "checkpoint", "save progress to resume a scan")
+	case "cold":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "cold", "ignore the cache and reread every archive")
+	case "nocache":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "nocache", "do not use or save the cache of scanned archives")
+	case "watch":
+		fmt.Fprintf(tw, "    -%v\t%v\n", "watch", "watch for new zip archives until interrupted")
+	case "hashdb":
+		fmt.Fprintf(tw, "    -%v=FILE\t%v\n", "hashdb", "only show comments not in the hash file")
+		fmt.Fprintf(tw, "    -%v\t%v\n", "hashdb-list", "list the hashes in the hash file")
+		fmt.Fprintf(tw, "    -%v=AGE\t%v\n", "hashdb-prune", "prune hashes older than 30d, 72h or missing")
 	case "quiet":
 		fmt.Fprintf(tw, "    -%v, -%v\t%v\n", "q", "quiet", "quiet mode (errors only)")
 	case "version":
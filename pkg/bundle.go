@@ -0,0 +1,80 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+)
+
+// bundled is a comment of the Bundle file.
+type bundled struct {
+	path string    // path of the zip archive.
+	mod  time.Time // mod is the last modification time of the zip archive.
+	cmmt string    // cmmt is the comment.
+}
+
+// bundle adds the found comment to the Bundle file.
+func (c *Config) bundle(f found) {
+	if c.Bundle == "" {
+		return
+	}
+	c.bundled = append(c.bundled, bundled{path: f.path, mod: f.mod, cmmt: f.cmmt})
+}
+
+// writeBundle writes the comments to the Bundle file, each with a header of the
+// source path and date, and the optional table of contents of the TOC config.
+func (c *Config) writeBundle() {
+	if c.Bundle == "" {
+		return
+	}
+	if err := c.WriteBundle(c.Bundle); err != nil {
+		c.Error(err)
+		return
+	}
+	c.WriteLog(fmt.Sprintf("BUNDLE: %d comments >> %s", len(c.bundled), c.Bundle))
+}
+
+// WriteBundle writes all the found comments to the named file.
+func (c *Config) WriteBundle(name string) error {
+	const layout = "2006-01-02 15:04"
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return "unknown date"
+		}
+		return t.Format(layout)
+	}
+	const perm = 0o644
+	err := cmnt.WriteFile(name, perm, func(w io.Writer) error {
+		if c.TOC && len(c.bundled) > 0 {
+			fmt.Fprintln(w, "Contents")
+			fmt.Fprintln(w)
+			for i, b := range c.bundled {
+				fmt.Fprintf(w, "%4d. %s (%s)\n", i+1, c.display(b.path), date(b.mod))
+			}
+			fmt.Fprintln(w)
+		}
+		for i, b := range c.bundled {
+			if i > 0 || c.TOC {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s\n", strings.Repeat("─", fileID))
+			fmt.Fprintf(w, "%d. %s\n", i+1, c.display(b.path))
+			fmt.Fprintf(w, "   %s\n", date(b.mod))
+			fmt.Fprintf(w, "%s\n\n", strings.Repeat("─", fileID))
+			fmt.Fprint(w, b.cmmt)
+			if !strings.HasSuffix(b.cmmt, "\n") {
+				fmt.Fprintln(w)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bundle %w", err)
+	}
+	return nil
+}
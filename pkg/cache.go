@@ -0,0 +1,219 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+	gap "github.com/muesli/go-app-paths"
+)
+
+// cacheFile is the filename of the scan cache stored in the user data directory.
+const cacheFile = "cache.gob"
+
+type (
+	// cache of the zip archive comments, keyed by the absolute path of the archive.
+	cache map[string]cached
+	// cached is the comment of an unchanged zip archive.
+	cached struct {
+		Size int64    // Size of the zip archive in bytes.
+		Mod  int64    // Mod is the last modification time of the archive in Unix nanoseconds.
+		Hash [32]byte // Hash is the SHA-256 checksum of the trimmed Unicode comment.
+		Cmmt string   // Cmmt is the zip comment in its original encoding, which is empty for archives without one.
+		Text string   // Text is the comment decoded as Unicode text, unless it is the same as Cmmt.
+		seen bool     // seen is true when the archive was found by the current scan, it is not saved.
+	}
+)
+
+// SetCache sets the full path to the cache file.
+// Otherwise the Cache config uses a file in the user data directory.
+func (i *internal) SetCache(name string) {
+	i.cacheName = name
+}
+
+// CacheName returns the full path to the cache file.
+func (i *internal) CacheName() string {
+	return i.cacheName
+}
+
+// Hits returns the number of zip archives that were served from the cache.
+func (i *internal) Hits() int {
+	return i.hits
+}
+
+// loadCache reads the cache file into the Config.
+// The Cold config ignores any previously cached comments.
+func (c *Config) loadCache() {
+	if !c.Cache || c.cache != nil {
+		return
+	}
+	c.cache = make(cache)
+	if c.CacheName() == "" {
+		c.SetCache(cacheName())
+	}
+	if c.Cold {
+		return
+	}
+	f, err := os.Open(c.CacheName())
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		c.Error(fmt.Errorf("cache open: %w", err))
+		return
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&c.cache); err != nil {
+		c.Error(fmt.Errorf("cache decode %s: %w", c.CacheName(), err))
+		c.cache = make(cache)
+		return
+	}
+	c.WriteLog(fmt.Sprintf("CACHE: %d archives << %s", len(c.cache), c.CacheName()))
+}
+
+// saveCache writes the cache to the cache file.
+func (c *Config) saveCache() {
+	if !c.Cache || c.cache == nil || c.CacheName() == "" {
+		return
+	}
+	if n := c.pruneCache(); n > 0 {
+		c.WriteLog(fmt.Sprintf("CACHE: %d missing archives pruned", n))
+	}
+	dir := filepath.Dir(c.CacheName())
+	const perm = 0o755
+	if err := os.MkdirAll(dir, perm); err != nil {
+		c.Error(fmt.Errorf("cache directory: %w", err))
+		return
+	}
+	const mode = 0o644
+	if err := cmnt.WriteFile(c.CacheName(), mode, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(c.cache)
+	}); err != nil {
+		c.Error(fmt.Errorf("cache %w", err))
+		return
+	}
+	c.WriteLog(fmt.Sprintf("CACHE: %d archives >> %s", len(c.cache), c.CacheName()))
+}
+
+// read returns the found comment and the comment hash of the named zip archive.
+// Unchanged archives are served from the cache without being opened.
+func (c *Config) read(path string, d fs.DirEntry) (found, [32]byte, error) {
+	f := found{path: path}
+	info, err := d.Info()
+	if err == nil {
+		f.size, f.mod = info.Size(), info.ModTime()
+	}
+	if c.cache == nil || err != nil {
+		raw, err := readRaw(path)
+		if err != nil {
+			return f, [32]byte{}, err
+		}
+		f.raw = raw
+		if f.cmmt, err = c.decode(raw); err != nil || f.cmmt == "" || c.Dupes {
+			return f, [32]byte{}, err
+		}
+		return f, sum(f.cmmt), nil
+	}
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = path
+	}
+	size, mod := info.Size(), info.ModTime().UnixNano()
+	e, ok := c.cache[key]
+	if ok && e.Size == size && e.Mod == mod {
+		c.hits++
+	} else {
+		raw, err := readRaw(path)
+		if err != nil {
+			return f, [32]byte{}, err
+		}
+		text, err := decode(raw)
+		if err != nil {
+			return f, [32]byte{}, err
+		}
+		e = cached{
+			Size: size,
+			Mod:  mod,
+			Hash: [32]byte{},
+			Cmmt: raw,
+			Text: "",
+		}
+		if text != raw {
+			e.Text = text
+		}
+		if text != "" {
+			e.Hash = sum(text)
+		}
+	}
+	e.seen = true
+	c.cache[key] = e
+	f.raw, f.cmmt = e.Cmmt, e.text()
+	if c.Raw {
+		// the hash of the raw comment is not cached
+		f.cmmt = e.Cmmt
+		return f, [32]byte{}, nil
+	}
+	return f, e.Hash, nil
+}
+
+// text returns the cached comment as Unicode text.
+func (e cached) text() string {
+	if e.Text == "" {
+		return e.Cmmt
+	}
+	return e.Text
+}
+
+// decode returns the raw comment using the encoding of the Raw config.
+func (c *Config) decode(raw string) (string, error) {
+	if c.Raw || raw == "" {
+		return raw, nil
+	}
+	return decode(raw)
+}
+
+// pruneCache removes the cached archives stored within the Dirs that were not found by the scan,
+// such as deleted or renamed archives, and returns the number of removals.
+// The cache is not pruned after a cancelled or a resumed scan, as some archives were not walked,
+// nor by the Write and Strip modes, which do not read the comments from the cache.
+func (c *Config) pruneCache() int {
+	if c.cancel || c.resumed || c.mode != writeNone {
+		return 0
+	}
+	roots := c.roots()
+	n := 0
+	for key, e := range c.cache {
+		if e.seen || !within(key, roots) {
+			continue
+		}
+		delete(c.cache, key)
+		n++
+	}
+	return n
+}
+
+// sum returns the SHA-256 checksum of the trimmed comment that is used to find duplicates.
+func sum(cmmt string) [32]byte {
+	return sha256.Sum256([]byte(strings.TrimSpace(cmmt)))
+}
+
+func cacheName() string {
+	name, err := gap.NewScope(gap.User, "zipcmt").DataPath(cacheFile)
+	if err != nil {
+		dir, err2 := os.UserHomeDir()
+		if err2 != nil {
+			return cacheFile
+		}
+		name = filepath.Join(dir, ".zipcmt", cacheFile)
+	}
+	return name
+}
@@ -0,0 +1,222 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // the pure Go SQLite driver, which includes FTS5
+)
+
+// driver is the database/sql name of the SQLite driver.
+const driver = "sqlite"
+
+// schema of the catalogue, which is created when the DB file is new.
+// The comments_fts table is a full-text search index of the decoded comments.
+const schema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id       INTEGER PRIMARY KEY,
+	started  TEXT NOT NULL,
+	finished TEXT,
+	dirs     TEXT NOT NULL,
+	zips     INTEGER NOT NULL DEFAULT 0,
+	comments INTEGER NOT NULL DEFAULT 0,
+	complete INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS archives (
+	id       INTEGER PRIMARY KEY,
+	path     TEXT NOT NULL UNIQUE,
+	size     INTEGER NOT NULL,
+	modified TEXT NOT NULL,
+	scan_id  INTEGER NOT NULL REFERENCES scans (id)
+);
+CREATE TABLE IF NOT EXISTS comments (
+	id       INTEGER PRIMARY KEY,
+	sha256   TEXT NOT NULL UNIQUE,
+	raw      BLOB NOT NULL,
+	text     TEXT NOT NULL,
+	encoding TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS archive_comments (
+	archive_id INTEGER PRIMARY KEY REFERENCES archives (id),
+	comment_id INTEGER NOT NULL REFERENCES comments (id)
+);
+CREATE INDEX IF NOT EXISTS archive_comments_comment ON archive_comments (comment_id);
+CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5 (
+	text, content = 'comments', content_rowid = 'id'
+);
+CREATE TRIGGER IF NOT EXISTS comments_ai AFTER INSERT ON comments BEGIN
+	INSERT INTO comments_fts (rowid, text) VALUES (new.id, new.text);
+END;
+CREATE TRIGGER IF NOT EXISTS comments_ad AFTER DELETE ON comments BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+`
+
+// catalogue is the SQLite database of the DB config.
+type catalogue struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	scan  int64 // scan is the id of the scans row of this run.
+	prune bool  // prune removes the archives not found by a complete scan.
+}
+
+// openDB opens or creates the DB catalogue and records the start of a scan run.
+func (c *Config) openDB() error {
+	if c.DB == "" || c.cat != nil {
+		return nil
+	}
+	db, err := sql.Open(driver, c.DB)
+	if err != nil {
+		return fmt.Errorf("db open %s: %w", c.DB, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return fmt.Errorf("db schema %s: %w", c.DB, err)
+	}
+	res, err := db.Exec("INSERT INTO scans (started, dirs) VALUES (?, ?)",
+		time.Now().Format(time.RFC3339Nano), strings.Join(c.Dirs, "\n"))
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("db scan %s: %w", c.DB, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("db scan %s: %w", c.DB, err)
+	}
+	// a resumed scan does not revisit the archives of the interrupted scan,
+	// the subdirectories are not scanned by NoWalk, and the write modes do not catalogue the archives
+	c.cat = &catalogue{db: db, scan: id, prune: c.skip == "" && !c.NoWalk && c.mode == writeNone}
+	c.WriteLog(fmt.Sprintf("DB: scan %d << %s", id, c.DB))
+	return nil
+}
+
+// catalogue upserts the found zip archive and its comment into the DB catalogue.
+// Archives without a comment are kept without a link to the comments table.
+func (c *Config) catalogue(f found) {
+	if c.cat == nil {
+		return
+	}
+	if err := c.upsert(f); err != nil {
+		c.Error(fmt.Errorf("db %s: %w", f.path, err))
+	}
+}
+
+func (c *Config) upsert(f found) error {
+	if c.cat.tx == nil {
+		tx, err := c.cat.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin: %w", err)
+		}
+		c.cat.tx = tx
+	}
+	tx := c.cat.tx
+	if abs, err := filepath.Abs(f.path); err == nil {
+		f.path = abs
+	}
+	r := c.newRecord(f)
+	if _, err := tx.Exec(`INSERT INTO archives (path, size, modified, scan_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET size = excluded.size, modified = excluded.modified,
+		scan_id = excluded.scan_id`,
+		r.Path, r.Size, r.Modified.Format(time.RFC3339Nano), c.cat.scan); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	var archive int64
+	if err := tx.QueryRow("SELECT id FROM archives WHERE path = ?", r.Path).Scan(&archive); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM archive_comments WHERE archive_id = ?", archive); err != nil {
+		return fmt.Errorf("link: %w", err)
+	}
+	if f.cmmt == "" {
+		return nil
+	}
+	if _, err := tx.Exec(`INSERT INTO comments (sha256, raw, text, encoding) VALUES (?, ?, ?, ?)
+		ON CONFLICT (sha256) DO NOTHING`,
+		r.SHA256, r.Raw, r.Comment, r.Encoding); err != nil {
+		return fmt.Errorf("comment: %w", err)
+	}
+	var comment int64
+	if err := tx.QueryRow("SELECT id FROM comments WHERE sha256 = ?", r.SHA256).Scan(&comment); err != nil {
+		return fmt.Errorf("comment: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO archive_comments (archive_id, comment_id) VALUES (?, ?)",
+		archive, comment); err != nil {
+		return fmt.Errorf("link: %w", err)
+	}
+	return nil
+}
+
+// commitDB commits the pending changes to the DB catalogue.
+func (c *Config) commitDB() {
+	if c.cat == nil || c.cat.tx == nil {
+		return
+	}
+	if err := c.cat.tx.Commit(); err != nil {
+		c.Error(fmt.Errorf("db commit: %w", err))
+	}
+	c.cat.tx = nil
+}
+
+// closeDB finishes the scan run and closes the DB catalogue.
+// A complete scan removes the archives of the Dirs that no longer exist,
+// and any comments that are no longer used by an archive.
+func (c *Config) closeDB() {
+	if c.cat == nil {
+		return
+	}
+	defer func() {
+		c.cat.db.Close()
+		c.cat = nil
+	}()
+	c.commitDB()
+	complete := !c.cancel && c.cat.prune
+	if complete {
+		if err := c.pruneDB(); err != nil {
+			c.Error(fmt.Errorf("db prune: %w", err))
+		}
+	}
+	if _, err := c.cat.db.Exec("UPDATE scans SET finished = ?, zips = ?, comments = ?, complete = ? WHERE id = ?",
+		time.Now().Format(time.RFC3339Nano), c.Zips, c.Cmmts, complete, c.cat.scan); err != nil {
+		c.Error(fmt.Errorf("db scan: %w", err))
+		return
+	}
+	c.WriteLog(fmt.Sprintf("DB: scan %d >> %s", c.cat.scan, c.DB))
+}
+
+func (c *Config) pruneDB() error {
+	tx, err := c.cat.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	const sep = string(filepath.Separator)
+	for _, root := range c.Dirs {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		prefix := strings.TrimSuffix(abs, sep) + sep
+		if _, err := tx.Exec("DELETE FROM archives WHERE scan_id <> ? AND substr(path, 1, length(?)) = ?",
+			c.cat.scan, prefix, prefix); err != nil {
+			return fmt.Errorf("archives: %w", err)
+		}
+	}
+	for _, query := range []string{
+		"DELETE FROM archive_comments WHERE archive_id NOT IN (SELECT id FROM archives)",
+		"DELETE FROM comments WHERE id NOT IN (SELECT comment_id FROM archive_comments)",
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("orphans: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/bloom"
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/bengarrett/zipcmt/internal/diskset"
+)
+
+var (
+	// ErrCheckpoint is returned when the checkpoint file was created using different directories.
+	ErrCheckpoint = errors.New("checkpoint was created for a different set of directories")
+	// ErrCollect is returned when an output that is collected until the end of the scan is used with a Checkpoint.
+	ErrCollect = errors.New("this output is written once the scan is finished and cannot be used with a checkpoint")
+)
+
+// checkpointEvery is the minimum duration between the periodic saves of the checkpoint file.
+const checkpointEvery = 15 * time.Second
+
+// checkpoint is the saved progress of a scan that is used to resume an interrupted scan.
+type checkpoint struct {
+	Dirs    []string            // Dirs are the directory paths of the scan.
+	Index   int                 // Index of the directory in Dirs that was being walked.
+	Path    string              // Path of the last completed zip archive, in walk order.
+	Zips    int                 // Zips is the number of zip files scanned.
+	Cmmts   int                 // Cmmts are the number of zip comments found.
+	Total   int                 // Total is the expected number of zip files to scan.
+	Saved   int                 // Saved are the number of comment text files saved.
+	Names   uint                // Names is the total length of the saved filenames.
+	Hashes  hash                // Hashes of the unique comments in the memory store.
+	Bloom   *bloom.Filter       // Bloom filter of the unique comments in the bloom store.
+	Exports cmnt.Export         // Exports are the previously used SaveName text filenames.
+	Owners  map[[32]byte]*owner // Owners are the buffered comments of the Keep config.
+	Order   int                 // Order is the number of buffered owners.
+	Shown   int                 // Shown are the number of comments output, for the Limit config.
+}
+
+// resume loads the Checkpoint file and restores the counters, hashes and export names.
+// It returns the index of the Dirs to resume from, or 0 when there is no checkpoint.
+func (c *Config) resume() (int, error) {
+	if c.Checkpoint == "" {
+		return 0, nil
+	}
+	if _, ok := c.hashes.(*diskset.Set); ok {
+		return 0, ErrDedupPoint
+	}
+	if name := c.collected(); name != "" {
+		return 0, fmt.Errorf("%w: %s", ErrCollect, name)
+	}
+	f, err := os.Open(c.Checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("checkpoint open: %w", err)
+	}
+	defer f.Close()
+	var cp checkpoint
+	if err := gob.NewDecoder(f).Decode(&cp); err != nil {
+		return 0, fmt.Errorf("checkpoint decode %s: %w", c.Checkpoint, err)
+	}
+	if !slices.Equal(cp.Dirs, c.Dirs) {
+		return 0, fmt.Errorf("%w: %s", ErrCheckpoint, c.Checkpoint)
+	}
+	c.Zips, c.Cmmts, c.total = cp.Zips, cp.Cmmts, cp.Total
+	c.saved, c.names = cp.Saved, cp.Names
+	switch c.hashes.(type) {
+	case hash:
+		if cp.Hashes != nil {
+			c.hashes = cp.Hashes
+		}
+	case *bloom.Filter:
+		if cp.Bloom != nil {
+			c.hashes = cp.Bloom
+		}
+	}
+	if cp.Exports != nil {
+		c.exports = cp.Exports
+	}
+	c.owners, c.order = cp.Owners, cp.Order
+	c.shown = cp.Shown
+	c.skip = cp.Path
+	c.resumed = true
+	c.WriteLog(fmt.Sprintf("RESUME: %s << %s", cp.Path, c.Checkpoint))
+	return cp.Index, nil
+}
+
+// collected returns the name of the config whose output is collected in memory
+// and written once the scan is finished, or an empty string when there is none.
+// These outputs are not saved by a checkpoint, so a resumed scan would lose them.
+func (c *Config) collected() string {
+	switch {
+	case c.Bundle != "":
+		return "bundle"
+	case c.HTML != "":
+		return "html"
+	case c.Report:
+		return "report"
+	case c.format == formatJSON:
+		return "json format"
+	case c.sortBy != sortNone:
+		return "sort"
+	}
+	return ""
+}
+
+// completed records the path as the last completed zip archive,
+// and periodically saves the Checkpoint file.
+func (c *Config) completed(path string) {
+	if c.Checkpoint == "" {
+		return
+	}
+	c.last = path
+	if time.Since(c.point) < checkpointEvery {
+		return
+	}
+	c.saveCheckpoint()
+}
+
+// saveCheckpoint writes the progress of the scan to the Checkpoint file.
+func (c *Config) saveCheckpoint() {
+	if c.Checkpoint == "" || c.last == "" {
+		return
+	}
+	c.point = time.Now()
+	cp := checkpoint{
+		Dirs:    c.Dirs,
+		Index:   c.root,
+		Path:    c.last,
+		Zips:    c.Zips,
+		Cmmts:   c.Cmmts,
+		Total:   c.total,
+		Saved:   c.saved,
+		Names:   c.names,
+		Exports: c.exports,
+		Owners:  c.owners,
+		Order:   c.order,
+		Shown:   c.shown,
+	}
+	switch h := c.hashes.(type) {
+	case hash:
+		cp.Hashes = h
+	case *bloom.Filter:
+		cp.Bloom = h
+	}
+	const perm = 0o644
+	if err := cmnt.WriteFile(c.Checkpoint, perm, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(cp)
+	}); err != nil {
+		c.Error(fmt.Errorf("checkpoint %w", err))
+		return
+	}
+	c.WriteLog("CHECKPOINT: " + c.last)
+}
+
+// removeCheckpoint deletes the Checkpoint file of a finished scan.
+func (c *Config) removeCheckpoint() {
+	if c.Checkpoint == "" {
+		return
+	}
+	if err := os.Remove(c.Checkpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.Error(fmt.Errorf("checkpoint remove: %w", err))
+	}
+}
+
+// skipped reports whether the path was completed by the resumed scan,
+// and whether the walk should skip the whole directory.
+func (c *Config) skipped(path string, d fs.DirEntry) (bool, error) {
+	const sep = string(filepath.Separator)
+	if c.skip == "" {
+		return false, nil
+	}
+	switch n := cmnt.WalkOrder(path, c.skip); {
+	case n == 0:
+		// the last completed zip archive
+		c.skip = ""
+		return true, nil
+	case n > 0:
+		// the last completed zip archive no longer exists
+		c.skip = ""
+		return false, nil
+	case d.IsDir() && !strings.HasPrefix(c.skip, strings.TrimSuffix(path, sep)+sep):
+		return true, fs.SkipDir
+	default:
+		return true, nil
+	}
+}
@@ -0,0 +1,55 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrColor is returned when the colour mode is unknown.
+var ErrColor = errors.New("unknown color mode, use auto, always or never")
+
+// UseColor reports whether the colour mode allows coloured output to a stream,
+// where the tty argument is true when the stream is a terminal.
+// The auto mode follows the NO_COLOR and FORCE_COLOR environment variables returned by getenv,
+// otherwise colour is only used by terminals that are not dumb.
+func UseColor(mode string, tty bool, getenv func(string) string) (bool, error) {
+	switch strings.ToLower(mode) {
+	case "always", "force":
+		return true, nil
+	case "never", "none":
+		return false, nil
+	case "", "auto":
+	default:
+		return false, fmt.Errorf("%w: %q", ErrColor, mode)
+	}
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	if getenv("NO_COLOR") != "" {
+		return false, nil
+	}
+	switch strings.ToLower(getenv("FORCE_COLOR")) {
+	case "":
+	case "0", "false", "no", "off":
+		return false, nil
+	default:
+		return true, nil
+	}
+	return tty && getenv("TERM") != "dumb", nil
+}
+
+// Terminal reports whether the file is a terminal rather than a pipe or a file.
+func Terminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
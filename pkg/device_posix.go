@@ -0,0 +1,23 @@
+//go:build !windows
+
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// device returns the ID of the device containing the file.
+// The ok value is false when the device cannot be determined.
+func device(info fs.FileInfo) (uint64, bool) {
+	if info == nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return 0, false
+	}
+	return uint64(st.Dev), true //nolint:unconvert,gosec
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import "io/fs"
+
+// device is not supported on Windows, where drives are
+// not mounted into the directory tree of other drives.
+func device(_ fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -33,8 +33,8 @@ func ExampleConfig_WalkDir() {
 	}
 	// Output:
 	// ── ..\test\subdir\test-with-comment.zip ─┐
-	//    This is an example test comment for zipcmmt.[0m
+	//    This is an example test comment for zipcmmt.
 	//
 	//  ── ..\test\test-with-comment.zip ────────┐
-	//    This is an example test comment for zipcmmt.[0m
+	//    This is an example test comment for zipcmmt.
 }
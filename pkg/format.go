@@ -0,0 +1,337 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gookit/color"
+)
+
+// ErrFormat is returned when the Format config is unknown.
+var ErrFormat = errors.New("unknown format, use text, json, ndjson, csv or tsv")
+
+// format of the scan results written to stdout.
+type format uint8
+
+const (
+	formatText     format = iota // the decorated comments and the Status summary
+	formatJSON                   // a single JSON document written after the scan
+	formatNDJSON                 // a JSON object per line, written while scanning
+	formatCSV                    // a comma-separated values table, written while scanning
+	formatTSV                    // a tab-separated values table, written while scanning
+	formatTemplate               // the Template config, written while scanning
+	formatList                   // the paths of the List and ListEmpty configs, written while scanning
+)
+
+// The record types of the ndjson format.
+const (
+	typeComment = "comment"
+	typeError   = "error"
+	typeSummary = "summary"
+)
+
+type (
+	// Record is the scan result of a zip archive with a comment.
+	Record struct {
+		Path      string    `json:"path"`            // Path of the zip archive.
+		Size      int64     `json:"size"`            // Size of the zip archive in bytes.
+		Modified  time.Time `json:"modified"`        // Modified is the last modification time of the archive.
+		Comment   string    `json:"comment"`         // Comment decoded as Unicode text.
+		Raw       []byte    `json:"raw"`             // Raw is the comment in its original encoding.
+		Encoding  string    `json:"encoding"`        // Encoding used to decode the comment, either ascii or cp437.
+		SHA256    string    `json:"sha256"`          // SHA256 checksum of the trimmed comment.
+		Duplicate bool      `json:"duplicate"`       // Duplicate is true when the comment was found in an earlier archive.
+		Saved     []string  `json:"saved,omitempty"` // Saved are the paths of the comment text files.
+	}
+	// Totals are the scan counters that are summarized by Status.
+	Totals struct {
+		Zips      int    `json:"zips"`           // Zips is the number of zip files scanned.
+		Comments  int    `json:"comments"`       // Comments are the number of comments found.
+		Unique    bool   `json:"unique"`         // Unique is true when the comments exclude duplicates.
+		Saved     int    `json:"saved"`          // Saved are the number of comment text files saved.
+		Cached    int    `json:"cached"`         // Cached are the number of zip files served from the cache.
+		Near      int    `json:"nearDuplicates"` // Near are the number of near duplicates ignored.
+		Written   int    `json:"written"`        // Written are the number of archive comments rewritten.
+		Cancelled bool   `json:"cancelled"`      // Cancelled is true when the scan was interrupted.
+		Elapsed   string `json:"elapsed"`        // Elapsed is the duration of the scan.
+	}
+	// fault is the error record of the ndjson format.
+	fault struct {
+		Type  string `json:"type"`
+		Path  string `json:"path,omitempty"`
+		Error string `json:"error"`
+	}
+)
+
+func parseFormat(s string) (format, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return formatText, nil
+	case "json":
+		return formatJSON, nil
+	case "ndjson", "jsonl":
+		return formatNDJSON, nil
+	case "csv":
+		return formatCSV, nil
+	case "tsv":
+		return formatTSV, nil
+	}
+	return formatText, fmt.Errorf("%w: %q", ErrFormat, s)
+}
+
+// Machine reports whether the Format config is a machine readable format,
+// which replaces the decorated comments and the Status summary.
+func (i *internal) Machine() bool {
+	return i.format != formatText
+}
+
+// SetOutput sets the writer of the streamed formats, which otherwise is stdout.
+func (i *internal) SetOutput(w io.Writer) {
+	i.out = w
+}
+
+// list prints the path of a zip archive for the List and ListEmpty configs,
+// which is terminated by a newline or by a NUL character with the Print0 config.
+func (c *Config) list(path string) {
+	end := "\n"
+	if c.Print0 {
+		end = "\x00"
+	}
+	fmt.Fprint(c.writer(), c.plain(path)+end)
+}
+
+// writer returns the output of the streamed formats.
+func (c *Config) writer() io.Writer {
+	if c.out == nil {
+		return os.Stdout
+	}
+	return c.out
+}
+
+// setFormat sets the format of the scan results.
+// Machine readable formats disable colour and send any error tips to stderr.
+func (c *Config) setFormat(f format) {
+	c.format = f
+	if !c.Machine() {
+		return
+	}
+	color.Enable = false
+	color.SetOutput(os.Stderr)
+}
+
+// Totals returns the scan counters.
+func (c *Config) Totals() Totals {
+	t := Totals{
+		Zips:      c.Zips,
+		Comments:  c.Cmmts,
+		Unique:    !c.Dupes,
+		Saved:     c.saved,
+		Cached:    c.hits,
+		Near:      c.near,
+		Written:   c.written,
+		Cancelled: c.cancel,
+		Elapsed:   "",
+	}
+	if !c.test {
+		t.Elapsed = c.Timer().String()
+	}
+	return t
+}
+
+// newRecord returns the scan result of the found comment.
+func (c *Config) newRecord(f found) Record {
+	r := Record{
+		Path:     f.path,
+		Size:     f.size,
+		Modified: f.mod,
+		Comment:  f.cmmt,
+		Encoding: "ascii",
+	}
+	if f.cmmt == "" {
+		return r
+	}
+	// the comment in both its original encoding and as Unicode text
+	raw := f.raw
+	if c.Raw {
+		s, err := decode(f.cmmt)
+		if err != nil {
+			c.Error(err)
+		}
+		r.Comment = s
+	}
+	r.Raw = []byte(raw)
+	for i := range len(raw) {
+		if raw[i] > 0x7f {
+			r.Encoding = "cp437"
+			break
+		}
+	}
+	h := sum(r.Comment)
+	r.SHA256 = hex.EncodeToString(h[:])
+	return r
+}
+
+// record adds the found comment to the scan results of a machine readable format.
+func (c *Config) record(f found, dupe bool, saved []string) {
+	if !c.Machine() {
+		return
+	}
+	if c.format == formatList {
+		// the list only needs the path
+		if !dupe && c.List {
+			c.list(f.path)
+		}
+		return
+	}
+	r := c.newRecord(f)
+	r.Path, r.Duplicate, r.Saved = c.plain(f.path), dupe, saved
+	switch c.format {
+	case formatNDJSON:
+		c.stream(struct {
+			Type string `json:"type"`
+			*Record
+		}{typeComment, &r})
+	case formatCSV, formatTSV:
+		// the table uses the same dedup options as the text format
+		if !dupe {
+			c.row(r)
+		}
+	case formatTemplate:
+		if !dupe {
+			c.execute(tmplResult, r)
+		}
+	case formatJSON:
+		c.records = append(c.records, r)
+	case formatText, formatList:
+	}
+}
+
+// heading creates the csv or tsv table writer and writes the table heading.
+func (c *Config) heading(w io.Writer) {
+	c.table = csv.NewWriter(w)
+	if c.format == formatTSV {
+		c.table.Comma = '\t'
+	}
+	s := []string{"path", "size", "modified", "length", "lines", "encoding", "sha256", "saved"}
+	if c.Text {
+		s = append(s, "comment")
+	}
+	_ = c.table.Write(s)
+}
+
+// row writes the record as a row of the csv or tsv table.
+// The Text config includes the comment, which is quoted when it contains newlines.
+func (c *Config) row(r Record) {
+	if c.table == nil {
+		c.heading(c.writer())
+	}
+	lines := 0
+	if s := strings.TrimRight(r.Comment, "\r\n"); s != "" {
+		lines = strings.Count(s, "\n") + 1
+	}
+	mod := ""
+	if !r.Modified.IsZero() {
+		mod = r.Modified.Format(time.RFC3339)
+	}
+	s := []string{
+		r.Path,
+		strconv.FormatInt(r.Size, 10),
+		mod,
+		strconv.Itoa(utf8.RuneCountInString(r.Comment)),
+		strconv.Itoa(lines),
+		r.Encoding,
+		r.SHA256,
+		strings.Join(r.Saved, ";"),
+	}
+	if c.Text {
+		s = append(s, r.Comment)
+	}
+	_ = c.table.Write(s)
+	c.table.Flush()
+	if err := c.table.Error(); err != nil {
+		color.Error.Tips(fmt.Sprintf("table write: %s", err))
+	}
+}
+
+// fault streams the error as a record of the ndjson format.
+// The path is the optional zip archive that caused the error.
+func (c *Config) fault(path string, err error) {
+	if c.format != formatNDJSON || err == nil {
+		return
+	}
+	c.stream(fault{Type: typeError, Path: path, Error: err.Error()})
+}
+
+// stream writes the record as a line of JSON to the output.
+func (c *Config) stream(v any) {
+	if err := json.NewEncoder(c.writer()).Encode(v); err != nil {
+		color.Error.Tips(fmt.Sprintf("json encode: %s", err))
+	}
+}
+
+// Summary writes the summary of the scan to w, which is the Status text
+// or the results document of the json Format, or the summary record of ndjson.
+// The csv and tsv tables and the lists have no summary, and the Template config uses the Footer.
+func (c *Config) Summary(w io.Writer) error {
+	s := c.Status()
+	switch c.format {
+	case formatText:
+		_, err := fmt.Fprintln(w, s)
+		return err
+	case formatNDJSON:
+		t := c.Totals()
+		if err := json.NewEncoder(w).Encode(struct {
+			Type string `json:"type"`
+			*Totals
+		}{typeSummary, &t}); err != nil {
+			return fmt.Errorf("json encode: %w", err)
+		}
+		return nil
+	case formatList:
+		return nil
+	case formatTemplate:
+		out := c.out
+		c.out = w
+		c.execute(tmplFooter, c.Totals())
+		c.out = out
+		return nil
+	case formatCSV, formatTSV:
+		// a table without any rows still has a heading
+		if c.table == nil {
+			c.heading(w)
+			c.table.Flush()
+		}
+		if err := c.table.Error(); err != nil {
+			return fmt.Errorf("table write: %w", err)
+		}
+		return nil
+	case formatJSON:
+	}
+	doc := struct {
+		Results []Record `json:"results"`
+		Status  Totals   `json:"status"`
+	}{
+		Results: c.records,
+		Status:  c.Totals(),
+	}
+	if doc.Results == nil {
+		doc.Results = []Record{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("json encode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/bloom"
+	"github.com/bengarrett/zipcmt/internal/diskset"
+	"github.com/bengarrett/zipcmt/internal/hashdb"
+)
+
+var (
+	// ErrDedup is returned when the Dedup store is unknown.
+	ErrDedup = errors.New("unknown dedup store, use memory, disk or bloom")
+	// ErrDedupPoint is returned when the disk Dedup store is used with a Checkpoint.
+	ErrDedupPoint = errors.New("the disk dedup store cannot be saved by a checkpoint, use the memory or bloom store")
+)
+
+// store is a set of the unique comment hashes.
+type store interface {
+	Has(sum [32]byte) bool // Has reports whether the comment hash is in the store.
+	Add(sum [32]byte)      // Add the comment hash to the store.
+	Len() int              // Len returns the number of comment hashes in the store.
+	Size() uint64          // Size returns the approximate memory or disk use of the store in bytes.
+}
+
+// Has reports whether the comment hash is in the map.
+func (h hash) Has(sum [32]byte) bool {
+	return h[sum]
+}
+
+// Add the comment hash to the map.
+func (h hash) Add(sum [32]byte) {
+	h[sum] = true
+}
+
+// Len returns the number of comment hashes in the map.
+func (h hash) Len() int {
+	return len(h)
+}
+
+// Size returns the approximate memory use of the map in bytes.
+func (h hash) Size() uint64 {
+	// a 32 byte key and 1 byte value, plus the map bucket overheads
+	const entry = 48
+	return uint64(len(h)) * entry
+}
+
+// store returns a new, empty store of comment hashes for the Dedup config.
+// The memory store is used when the other stores cannot be created.
+func (c *Config) store() store {
+	switch strings.ToLower(c.Dedup) {
+	case "", "memory":
+	case "bloom":
+		return bloom.New(c.FalsePositive)
+	case "disk":
+		s, err := diskset.New("")
+		if err == nil {
+			return s
+		}
+		c.Error(err)
+	}
+	return make(hash)
+}
+
+// parseDedup returns an error when the Dedup store is unknown.
+func parseDedup(s string) error {
+	switch strings.ToLower(s) {
+	case "", "memory", "bloom", "disk":
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrDedup, s)
+}
+
+// closeStore closes and removes the temporary file of a disk store.
+func (c *Config) closeStore() {
+	s, ok := c.hashes.(*diskset.Set)
+	if !ok {
+		return
+	}
+	if err := s.Err(); err != nil {
+		c.Error(err)
+	}
+	if err := s.Close(); err != nil {
+		c.Error(err)
+	}
+	c.hashes = nil
+}
+
+// openHashDB reads the HashDB file and adds its comment hashes to the duplicate checks.
+func (c *Config) openHashDB() error {
+	if c.HashDB == "" || c.Dupes || c.hashdb != nil {
+		return nil
+	}
+	db, err := hashdb.Open(c.HashDB)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	db.Sums(func(sum hashdb.Sum) {
+		c.hashes.Add(sum)
+	})
+	c.hashdb = db
+	c.WriteLog(fmt.Sprintf("HASHDB: %d hashes << %s", db.Len(), db.Name()))
+	return nil
+}
+
+// addHash records the first use of a unique comment to the HashDB.
+func (c *Config) addHash(sum [32]byte, path string) {
+	if c.hashdb == nil {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	c.hashdb.Add(sum, path, time.Now())
+}
+
+// saveHashDB writes any new comment hashes to the HashDB file.
+func (c *Config) saveHashDB() {
+	if c.hashdb == nil {
+		return
+	}
+	if err := c.hashdb.Save(); err != nil {
+		c.Error(err)
+		return
+	}
+	c.WriteLog(fmt.Sprintf("HASHDB: %d hashes >> %s", c.hashdb.Len(), c.hashdb.Name()))
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import "io/fs"
+
+// hiddenAttr is not supported on POSIX systems, which use dot files to hide files.
+// The file info of the entry is not read, to save a system call for every walked file.
+func hiddenAttr(_ fs.DirEntry) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hiddenAttr reports whether the file has the hidden or system attributes set.
+func hiddenAttr(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || attr == nil {
+		return false
+	}
+	const mask = syscall.FILE_ATTRIBUTE_HIDDEN | syscall.FILE_ATTRIBUTE_SYSTEM
+	return attr.FileAttributes&mask != 0
+}
@@ -0,0 +1,129 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrKeep is returned when the Keep owner policy is unknown.
+var ErrKeep = errors.New("unknown keep policy, use first, oldest, newest, shortest-path or largest")
+
+// keep is the owner policy of duplicate comments.
+type keep uint8
+
+const (
+	keepFirst    keep = iota // the first archive in walk order
+	keepOldest               // the archive with the oldest modification date
+	keepNewest               // the archive with the newest modification date
+	keepShortest             // the archive with the shortest path
+	keepLargest              // the largest archive
+)
+
+// owner is the zip archive that owns a buffered comment.
+type owner struct {
+	Order int       // Order the comment was first found.
+	Path  string    // Path of the zip archive.
+	Cmmt  string    // Cmmt is the comment of the zip archive.
+	Raw   string    // Raw is the comment in its original encoding.
+	Mod   time.Time // Mod is the last modification time of the zip archive.
+	Size  int64     // Size of the zip archive in bytes.
+}
+
+func parseKeep(s string) (keep, error) {
+	switch strings.ToLower(s) {
+	case "", "first":
+		return keepFirst, nil
+	case "oldest":
+		return keepOldest, nil
+	case "newest":
+		return keepNewest, nil
+	case "shortest-path", "shortest":
+		return keepShortest, nil
+	case "largest":
+		return keepLargest, nil
+	}
+	return keepFirst, fmt.Errorf("%w: %q", ErrKeep, s)
+}
+
+// candidate returns the found zip archive as a possible owner of the comment.
+func candidate(f found) *owner {
+	return &owner{Path: f.path, Cmmt: f.cmmt, Raw: f.raw, Mod: f.mod, Size: f.size}
+}
+
+// found returns the comment of the owner.
+func (o *owner) found() found {
+	return found{path: o.Path, cmmt: o.Cmmt, raw: o.Raw, size: o.Size, mod: o.Mod}
+}
+
+// buffer holds the unique comment until the end of the scan, when the Keep policy
+// requires a choice of owner. It returns false when the comment should be output now.
+func (c *Config) buffer(hash [32]byte, f found) bool {
+	if c.keep == keepFirst || c.Dupes {
+		return false
+	}
+	if c.owners == nil {
+		c.owners = make(map[[32]byte]*owner)
+	}
+	o := candidate(f)
+	o.Order = c.order
+	c.order++
+	c.owners[hash] = o
+	return true
+}
+
+// contest replaces the owner of a buffered comment with the found duplicate,
+// when it is a better match for the Keep policy.
+func (c *Config) contest(hash [32]byte, f found) {
+	o, ok := c.owners[hash]
+	if !ok {
+		return
+	}
+	x := candidate(f)
+	if !c.keep.better(x, o) {
+		return
+	}
+	c.WriteLog(fmt.Sprintf("OWNER: %s << %s", c.display(x.Path), c.display(o.Path)))
+	o.Path, o.Cmmt, o.Raw, o.Mod, o.Size = x.Path, x.Cmmt, x.Raw, x.Mod, x.Size
+}
+
+// better reports whether the candidate x is a better owner than o.
+// Ties are kept by the existing owner, which was found first.
+func (k keep) better(x, o *owner) bool {
+	switch k {
+	case keepOldest:
+		return x.Mod.Before(o.Mod)
+	case keepNewest:
+		return x.Mod.After(o.Mod)
+	case keepShortest:
+		return len(x.Path) < len(o.Path)
+	case keepLargest:
+		return x.Size > o.Size
+	case keepFirst:
+	}
+	return false
+}
+
+// flush prints and saves the buffered comments in the order they were first found.
+func (c *Config) flush() {
+	if len(c.owners) == 0 {
+		return
+	}
+	owners := slices.SortedFunc(maps.Values(c.owners), func(a, b *owner) int {
+		return cmp.Compare(a.Order, b.Order)
+	})
+	for _, o := range owners {
+		mod := o.Mod
+		if c.Now {
+			mod = time.Time{}
+		}
+		c.output(o.found(), mod)
+	}
+	clear(c.owners)
+}
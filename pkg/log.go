@@ -23,6 +23,7 @@ func (c *Config) Error(err error) {
 		return
 	}
 	color.Error.Tips(fmt.Sprint(err))
+	c.fault("", err)
 	c.WriteLog(fmt.Sprintf("ERROR: %s", err))
 }
 
@@ -61,10 +62,11 @@ func (c *Config) WriteLog(s string) {
 		c.logHeader(logger)
 	}
 	l := fmt.Sprintf("zip#: %07d; cmmt#: %07d; ", c.Zips, c.Cmmts)
-	if !c.Dupes {
-		const hashLen = 32
-		x := uint64(len(c.hashes)) * uint64(hashLen)
-		l += fmt.Sprintf("hashes: %s; ", humanize.Bytes(x))
+	if c.Cache {
+		l += fmt.Sprintf("hits#: %07d; ", c.hits)
+	}
+	if !c.Dupes && c.hashes != nil {
+		l += fmt.Sprintf("hashes: %s; ", humanize.Bytes(c.hashes.Size()))
 	}
 	if c.SaveName != "" {
 		l += fmt.Sprintf("names: %s; ", humanize.Bytes(uint64(c.names)))
@@ -84,6 +86,10 @@ func (c *Config) logHeader(logger *log.Logger) {
 	v := reflect.ValueOf(c).Elem()
 	t := v.Type()
 	for i := range v.NumField() {
+		// skip the internal fields, such as the hashes and the cache, which can be huge
+		if t.Field(i).Anonymous {
+			continue
+		}
 		fmt.Fprintf(w, "%02d. %s:\t\t%v\n", i+1, t.Field(i).Name, v.Field(i))
 		if t.Field(i).Name == "test" {
 			break
@@ -0,0 +1,96 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPaths is returned when the Paths style is unknown.
+var ErrPaths = errors.New("unknown paths style, use relative, absolute or home")
+
+// style of the displayed zip archive paths.
+type style uint8
+
+const (
+	pathWalked   style = iota // the path as walked, with the home directory as a tilde
+	pathRelative              // the path relative to its root directory or the Base
+	pathAbsolute              // the absolute path
+	pathHome                  // the absolute path, with the home directory as a tilde
+)
+
+func parseStyle(s string) (style, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return pathWalked, nil
+	case "relative", "rel":
+		return pathRelative, nil
+	case "absolute", "abs":
+		return pathAbsolute, nil
+	case "home", "tilde":
+		return pathHome, nil
+	}
+	return pathWalked, fmt.Errorf("%w: %q", ErrPaths, s)
+}
+
+// display returns the path of the zip archive in the Paths style,
+// which is used by the separators, the log and the output formats.
+func (c *Config) display(path string) string {
+	if c.style == pathWalked {
+		return c.home(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return c.home(path)
+	}
+	switch c.style {
+	case pathAbsolute:
+		return abs
+	case pathHome:
+		return c.home(abs)
+	case pathRelative:
+		if rel, err := filepath.Rel(c.relativeTo(abs), abs); err == nil {
+			return rel
+		}
+		return abs
+	case pathWalked:
+	}
+	return c.home(path)
+}
+
+// plain returns the path of the zip archive used by the lists and the machine readable formats.
+// Unlike display, the walked path is kept as is, as a tilde cannot be opened by other programs.
+func (c *Config) plain(path string) string {
+	if c.style == pathWalked {
+		return path
+	}
+	return c.display(path)
+}
+
+// relativeTo returns the absolute directory used for the relative paths, which is either
+// the Base config or the longest of the Dirs that contains the named file.
+func (c *Config) relativeTo(name string) string {
+	if c.Base != "" {
+		if abs, err := filepath.Abs(c.Base); err == nil {
+			return abs
+		}
+		return c.Base
+	}
+	const sep = string(filepath.Separator)
+	root := filepath.Dir(name)
+	match := 0
+	for _, dir := range c.Dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		prefix := strings.TrimSuffix(abs, sep) + sep
+		if strings.HasPrefix(name, prefix) && len(prefix) > match {
+			root, match = abs, len(prefix)
+		}
+	}
+	return root
+}
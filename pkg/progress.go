@@ -0,0 +1,171 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/gookit/color"
+)
+
+const (
+	barWidth = 30                     // barWidth is the number of characters used by the progress bar.
+	redraw   = 100 * time.Millisecond // redraw is the minimum duration between progress bar updates.
+	clearEOL = "\033[2K"              // clearEOL is the ANSI control to erase the current line.
+)
+
+// Total returns the expected number of zip archives to scan,
+// or 0 when it is unknown.
+func (i *internal) Total() int {
+	return i.total
+}
+
+// terminal reports whether the standard output is a terminal rather than a pipe or a file.
+func terminal() bool {
+	return Terminal(os.Stdout)
+}
+
+// estimate sets the expected number of zip archives to scan, for use by the progress bar.
+// The Count config walks the directories to count the archives, otherwise the total
+// is estimated from a resumed checkpoint or the number of archives in the cache.
+func (c *Config) estimate(ctx context.Context) {
+	if c.test || c.Print || c.Quiet || c.Machine() || !terminal() {
+		return
+	}
+	switch {
+	case c.Count:
+		fmt.Fprint(os.Stdout, "\r", color.Secondary.Sprint("Counting zip archives\u2026"))
+		c.total = c.count(ctx)
+		c.WriteLog(fmt.Sprintf("COUNT: %d zip archives", c.total))
+	case c.total > 0:
+		// the total of a resumed checkpoint
+	default:
+		c.total = c.cached()
+	}
+	c.bar = c.total > 0
+	c.begin, c.base = time.Now(), c.Zips
+}
+
+// cached returns the number of archives in the cache that are stored within the Dirs.
+func (c *Config) cached() int {
+	if len(c.cache) == 0 {
+		return 0
+	}
+	roots := c.roots()
+	n := 0
+	for key := range c.cache {
+		if within(key, roots) {
+			n++
+		}
+	}
+	return n
+}
+
+// roots returns the absolute paths of the Dirs, each with a trailing separator.
+func (c *Config) roots() []string {
+	roots := make([]string, 0, len(c.Dirs))
+	for _, root := range c.Dirs {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, strings.TrimSuffix(abs, string(filepath.Separator))+string(filepath.Separator))
+	}
+	return roots
+}
+
+// within reports whether the absolute path is stored within any of the roots.
+func within(path string, roots []string) bool {
+	for _, root := range roots {
+		if strings.HasPrefix(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// count walks the Dirs and returns the number of zip archives that would be scanned.
+func (c *Config) count(ctx context.Context) int {
+	n := 0
+	for _, root := range c.Dirs {
+		dev, xdev := c.device(root)
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				if errors.Is(err, fs.ErrPermission) && path != root {
+					return nil
+				}
+				return err
+			}
+			if path == root {
+				return nil
+			}
+			if d.IsDir() {
+				if c.NoWalk || c.hidden(path, d) || (xdev && otherDevice(d, dev)) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if cmnt.Valid(d.Name()) && !c.hidden(path, d) {
+				n++
+			}
+			return nil
+		})
+	}
+	return n
+}
+
+// progress prints the scan activity feedback.
+// A progress bar is used when the total number of archives is known,
+// otherwise it is a counter of the scanned archives.
+func (c *Config) progress() {
+	if c.test || c.Print || c.Quiet || c.DryRun || c.Machine() {
+		return
+	}
+	if !c.bar {
+		fmt.Fprint(os.Stdout, "\r", color.Secondary.Sprint("Scanned "),
+			color.Primary.Sprintf("%d zip archives", c.Zips))
+		return
+	}
+	if time.Since(c.drawn) < redraw && c.Zips < c.total {
+		return
+	}
+	c.drawn = time.Now()
+	fmt.Fprint(os.Stdout, "\r", clearEOL, Bar(c.Zips, c.total, c.Zips-c.base, time.Since(c.begin)))
+}
+
+// Bar returns a progress bar of the scanned zip archives, with the percentage completed,
+// the throughput and an estimated time of completion.
+// The done value is the number of archives scanned since the elapsed duration began.
+func Bar(zips, total, done int, elapsed time.Duration) string {
+	if total <= 0 {
+		return ""
+	}
+	zips = min(zips, total)
+	fill := zips * barWidth / total
+	pct := zips * 100 / total //nolint:mnd
+	s := color.Primary.Sprint(strings.Repeat("█", fill)) +
+		color.Secondary.Sprint(strings.Repeat("░", barWidth-fill)) +
+		color.Primary.Sprintf(" %3d%%", pct) +
+		color.Secondary.Sprintf(" %d/%d zips", zips, total)
+	if done <= 0 || elapsed <= 0 {
+		return s
+	}
+	rate := float64(done) / elapsed.Seconds()
+	s += color.Secondary.Sprintf(", %.0f/s", rate)
+	if remain := total - zips; remain > 0 && rate > 0 {
+		eta := time.Duration(float64(remain) / rate * float64(time.Second))
+		s += color.Secondary.Sprint(", ETA ") + color.Primary.Sprint(eta.Round(time.Second))
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gookit/color"
+)
+
+// group is a unique comment and the paths of every zip archive that uses it.
+type group struct {
+	order int      // order the comment was first found.
+	cmmt  string   // cmmt is the comment.
+	paths []string // paths of the zip archives with the comment.
+}
+
+// grouped adds the path of the zip archive to the group of the comment hash,
+// which is used by the Report and HTML configs.
+func (c *Config) grouped(hash [32]byte, path, cmmt string) {
+	if !c.Report && c.HTML == "" {
+		return
+	}
+	if hash == [32]byte{} {
+		hash = sum(c.norm.Apply(cmmt))
+	}
+	if c.groups == nil {
+		c.groups = make(map[[32]byte]*group)
+	}
+	g, ok := c.groups[hash]
+	if !ok {
+		g = &group{order: len(c.groups), cmmt: cmmt}
+		c.groups[hash] = g
+	}
+	g.paths = append(g.paths, path)
+}
+
+// WriteReport writes the duplicate report of the Report config.
+// Each unique comment is listed once with the paths of every zip archive that uses it,
+// sorted by the most used comments first. The comments are only written with the Print config.
+func (c *Config) WriteReport(w io.Writer) {
+	if w == nil {
+		return
+	}
+	groups := make([]*group, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, g)
+	}
+	slices.SortFunc(groups, func(a, b *group) int {
+		if n := cmp.Compare(len(b.paths), len(a.paths)); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.order, b.order)
+	})
+	for _, g := range groups {
+		a := "archive"
+		if len(g.paths) != 1 {
+			a += "s"
+		}
+		fmt.Fprint(w, heading(fmt.Sprintf("%d %s", len(g.paths), a)))
+		if c.Print {
+			fmt.Fprintf(w, "%s%s\n", g.cmmt, reset())
+		}
+		for _, path := range g.paths {
+			fmt.Fprintln(w, color.Secondary.Sprint("   • ")+color.Primary.Sprint(c.display(path)))
+		}
+	}
+	if len(groups) > 0 {
+		fmt.Fprintln(w, strings.Repeat("─", fileID))
+	}
+}
@@ -0,0 +1,280 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The layout of the static site that is written by WriteSite.
+const (
+	siteIndex  = "index.html"   // siteIndex lists the zip archives by directory.
+	siteJSON   = "index.json"   // siteJSON is the search index of the comments.
+	siteSearch = "search.js"    // siteSearch is the client-side search with an embedded copy of the index.
+	siteStyle  = "style.css"    // siteStyle is the shared stylesheet.
+	siteDir    = "comment"      // siteDir is the subdirectory of the comment pages.
+	sitePage   = 16             // sitePage is the number of hash characters used by a comment page filename.
+	siteFont   = "font.ttf"     // siteFont is the monospace font of the comments.
+	siteFontTx = "font.txt"     // siteFontTx is the license of the font.
+	siteTitle  = "zip comments" // siteTitle is the title of the index page.
+)
+
+var (
+	// goMono is the Go Mono font by Bigelow & Holmes, which has a glyph for every printable
+	// CP437 character, including the box drawing, block and shade characters.
+	//go:embed embed/gomono.ttf
+	goMono []byte
+	//go:embed embed/gomono.txt
+	goMonoLicense []byte
+)
+
+type (
+	// page is a unique comment of the static site.
+	page struct {
+		Name  string   `json:"page"`  // Name is the relative URL of the comment page.
+		Paths []string `json:"paths"` // Paths of the zip archives with the comment.
+		Text  string   `json:"text"`  // Text of the comment.
+	}
+	// folder is a directory of zip archives listed by the index page.
+	folder struct {
+		Dir   string
+		Files []file
+	}
+	// file is a zip archive listed by the index page.
+	file struct {
+		Name  string // Name of the zip archive.
+		Page  string // Page is the relative URL of the comment page.
+		Count int    // Count is the number of zip archives that share the comment.
+		Dupe  bool   // Dupe is true when the comment was first found in another archive.
+	}
+)
+
+// WriteSite writes a static HTML site of the grouped comments to the directory.
+// The site has an index page of the zip archives listed by directory, a page for each
+// unique comment with links to the archives that share it, and a client-side search.
+// The comments use an embedded copy of the Go Mono font, which has every CP437 character.
+// It needs no server and can be browsed using file:// URLs.
+func (c *Config) WriteSite(dir string) error {
+	pages := c.pages()
+	if err := os.MkdirAll(filepath.Join(dir, siteDir), 0o755); err != nil {
+		return fmt.Errorf("site directory: %w", err)
+	}
+	// the search index, which is also embedded in a script as browsers block fetch from file://
+	idx, err := json.Marshal(pages)
+	if err != nil {
+		return fmt.Errorf("site index: %w", err)
+	}
+	files := map[string][]byte{
+		siteJSON:   idx,
+		siteSearch: []byte("const zipcmtIndex = " + string(idx) + ";\n" + searchJS),
+		siteStyle:  []byte(fmt.Sprintf(styleCSS, siteFont)),
+		siteFont:   goMono,
+		siteFontTx: goMonoLicense,
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			return fmt.Errorf("site %s: %w", name, err)
+		}
+	}
+	for _, p := range pages {
+		if err := c.writePage(filepath.Join(dir, p.Name), p); err != nil {
+			return err
+		}
+	}
+	if err := c.writeIndex(filepath.Join(dir, siteIndex), pages); err != nil {
+		return err
+	}
+	c.WriteLog(fmt.Sprintf("SITE: %d comments >> %s", len(pages), dir))
+	return nil
+}
+
+// site writes the static site of the HTML config.
+func (c *Config) site() {
+	if c.HTML == "" {
+		return
+	}
+	if err := c.WriteSite(c.HTML); err != nil {
+		c.Error(err)
+	}
+}
+
+// pages returns the grouped comments in the order they were first found.
+func (c *Config) pages() []page {
+	keys := make([][32]byte, 0, len(c.groups))
+	for k := range c.groups {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b [32]byte) int {
+		return cmp.Compare(c.groups[a].order, c.groups[b].order)
+	})
+	pages := make([]page, 0, len(keys))
+	for _, k := range keys {
+		g := c.groups[k]
+		paths := make([]string, 0, len(g.paths))
+		for _, path := range g.paths {
+			paths = append(paths, c.display(path))
+		}
+		pages = append(pages, page{
+			Name:  siteDir + "/" + hex.EncodeToString(k[:])[:sitePage] + ".html",
+			Paths: paths,
+			Text:  g.cmmt,
+		})
+	}
+	return pages
+}
+
+func (c *Config) writePage(name string, p page) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("site page: %w", err)
+	}
+	defer f.Close()
+	if err := pageTmpl.Execute(f, p); err != nil {
+		return fmt.Errorf("site page %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *Config) writeIndex(name string, pages []page) error {
+	dirs := make(map[string]*folder)
+	for _, p := range pages {
+		for i, path := range p.Paths {
+			d := filepath.Dir(path)
+			if dirs[d] == nil {
+				dirs[d] = &folder{Dir: d}
+			}
+			dirs[d].Files = append(dirs[d].Files, file{
+				Name:  filepath.Base(path),
+				Page:  p.Name,
+				Count: len(p.Paths),
+				Dupe:  i > 0,
+			})
+		}
+	}
+	folders := make([]*folder, 0, len(dirs))
+	for _, d := range dirs {
+		slices.SortFunc(d.Files, func(a, b file) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		folders = append(folders, d)
+	}
+	slices.SortFunc(folders, func(a, b *folder) int {
+		return strings.Compare(a.Dir, b.Dir)
+	})
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("site index: %w", err)
+	}
+	defer f.Close()
+	data := struct {
+		Title   string
+		Comment int
+		Folders []*folder
+	}{siteTitle, len(pages), folders}
+	if err := indexTmpl.Execute(f, data); err != nil {
+		return fmt.Errorf("site index %s: %w", name, err)
+	}
+	return nil
+}
+
+var (
+	pageTmpl = template.Must(template.New("page").Funcs(template.FuncMap{
+		"base": filepath.Base,
+	}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{index .Paths 0 | base}}</title>
+<link rel="stylesheet" href="../style.css">
+</head>
+<body>
+<p><a href="../index.html">Index</a></p>
+<h1>{{index .Paths 0 | base}}</h1>
+<pre class="cp437">{{.Text}}</pre>
+<h2>{{len .Paths}} archive{{if gt (len .Paths) 1}}s, including duplicates{{end}}</h2>
+<ul>
+{{- range $i, $p := .Paths}}
+<li>{{$p}}{{if $i}} <span class="dupe">duplicate</span>{{end}}</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+	indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="style.css">
+<script src="search.js" defer></script>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Comment}} unique comments</p>
+<p><input id="search" type="search" placeholder="Search the comments and paths" autofocus></p>
+<ul id="results"></ul>
+{{- range .Folders}}
+<h2>{{.Dir}}</h2>
+<ul>
+{{- range .Files}}
+<li><a href="{{.Page}}">{{.Name}}</a>{{if gt .Count 1}} <span class="dupe">{{if .Dupe}}duplicate, {{end}}{{.Count}} archives</span>{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+)
+
+// searchJS filters the embedded zipcmtIndex by the text of the search input.
+const searchJS = `document.addEventListener("DOMContentLoaded", () => {
+  const input = document.getElementById("search");
+  const results = document.getElementById("results");
+  input.addEventListener("input", () => {
+    results.replaceChildren();
+    const q = input.value.trim().toLowerCase();
+    if (q.length < 2) return;
+    for (const c of zipcmtIndex) {
+      const hit = c.text.toLowerCase().includes(q) ||
+        c.paths.some((p) => p.toLowerCase().includes(q));
+      if (!hit) continue;
+      const li = document.createElement("li");
+      const a = document.createElement("a");
+      a.href = c.page;
+      a.textContent = c.paths[0];
+      li.append(a);
+      if (c.paths.length > 1) li.append(" (" + c.paths.length + " archives)");
+      results.append(li);
+    }
+  });
+});
+`
+
+// styleCSS renders the comments with an installed VGA font,
+// otherwise it uses the font written to the site directory.
+const styleCSS = `@font-face {
+  font-family: "zipcmt cp437";
+  src: local("Px437 IBM VGA 8x16"), local("Px437 IBM VGA8"), local("Perfect DOS VGA 437"),
+    url("%s") format("truetype");
+}
+body { font-family: sans-serif; margin: 2em; }
+.cp437 {
+  font-family: "zipcmt cp437", monospace;
+  line-height: 1;
+  white-space: pre;
+  background: #000;
+  color: #aaa;
+  padding: 1em;
+  display: inline-block;
+}
+.dupe { color: #888; }
+`
@@ -0,0 +1,191 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrSort is returned when the Sort order is unknown.
+var ErrSort = errors.New("unknown sort order, use path, mtime, size, length or count")
+
+// sortMemory is the total size of the buffered comments held in memory,
+// after which the comments are spilled to a temporary file.
+const sortMemory = 32 << 20
+
+// order of the sorted comments.
+type order uint8
+
+const (
+	sortNone   order = iota // the walk order
+	sortPath                // the path of the zip archive
+	sortMtime               // the last modification time of the zip archive, oldest first
+	sortSize                // the size of the zip archive, smallest first
+	sortLength              // the number of characters in the comment, shortest first
+	sortCount               // the number of zip archives that share the comment, least used first
+)
+
+// held is a buffered comment of the Sort config.
+type held struct {
+	path  string    // path of the zip archive.
+	mod   time.Time // mod time applied to the saved text files.
+	when  time.Time // when is the last modification time of the zip archive.
+	size  int64     // size of the zip archive in bytes.
+	chars int       // chars are the number of characters in the comment.
+	hash  [32]byte  // hash of the normalized comment.
+	cmmt  string    // cmmt is the comment, unless it is spilled.
+	raw   string    // raw is the comment in its original encoding, unless it is spilled.
+	off   int64     // off is the offset of a spilled comment, followed by the raw comment.
+	n     int       // n is the length in bytes of a spilled comment.
+	rawN  int       // rawN is the length in bytes of a spilled raw comment.
+}
+
+func parseSort(s string) (order, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return sortNone, nil
+	case "path":
+		return sortPath, nil
+	case "mtime", "date":
+		return sortMtime, nil
+	case "size":
+		return sortSize, nil
+	case "length":
+		return sortLength, nil
+	case "count":
+		return sortCount, nil
+	}
+	return sortNone, fmt.Errorf("%w: %q", ErrSort, s)
+}
+
+// tally counts the zip archives that share the comment, for the count Sort order.
+func (c *Config) tally(hash [32]byte, cmmt string) {
+	if c.sortBy != sortCount {
+		return
+	}
+	if hash == [32]byte{} {
+		hash = sum(c.norm.Apply(cmmt))
+	}
+	if c.counts == nil {
+		c.counts = make(map[[32]byte]int)
+	}
+	c.counts[hash]++
+}
+
+// hold buffers the found comment until the end of the scan,
+// when the Sort config is used. It returns false when the comment should be output now.
+// Once the buffered comments exceed the sortMemory, they are written to a temporary file.
+func (c *Config) hold(f found, mod time.Time) bool {
+	if c.sortBy == sortNone {
+		return false
+	}
+	h := held{
+		path:  f.path,
+		mod:   mod,
+		when:  f.mod,
+		size:  f.size,
+		chars: utf8.RuneCountInString(f.cmmt),
+		hash:  sum(c.norm.Apply(f.cmmt)),
+		cmmt:  f.cmmt,
+		raw:   f.raw,
+	}
+	if c.heldMem+len(f.cmmt)+len(f.raw) > sortMemory {
+		if err := c.spill(&h); err != nil {
+			c.Error(err)
+		}
+	}
+	c.heldMem += len(h.cmmt) + len(h.raw)
+	c.held = append(c.held, h)
+	return true
+}
+
+// spill writes the comment to the temporary spill file.
+func (c *Config) spill(h *held) error {
+	if c.spilled == nil {
+		f, err := os.CreateTemp("", "zipcmt-sort-*")
+		if err != nil {
+			return fmt.Errorf("sort spill: %w", err)
+		}
+		c.spilled = f
+	}
+	off, err := c.spilled.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("sort spill: %w", err)
+	}
+	n, err := io.WriteString(c.spilled, h.cmmt+h.raw)
+	if err != nil {
+		return fmt.Errorf("sort spill: %w", err)
+	}
+	h.off, h.n, h.rawN = off, len(h.cmmt), n-len(h.cmmt)
+	h.cmmt, h.raw = "", ""
+	return nil
+}
+
+// unspill returns the comment of a buffered comment.
+func (c *Config) unspill(h held) (found, error) {
+	f := found{path: h.path, cmmt: h.cmmt, raw: h.raw, size: h.size, mod: h.when}
+	if h.n == 0 || c.spilled == nil {
+		return f, nil
+	}
+	b := make([]byte, h.n+h.rawN)
+	if _, err := c.spilled.ReadAt(b, h.off); err != nil {
+		return f, fmt.Errorf("sort spill: %w", err)
+	}
+	f.cmmt, f.raw = string(b[:h.n]), string(b[h.n:])
+	return f, nil
+}
+
+// compare the buffered comments using the Sort order, with any ties in path order.
+func (c *Config) compare(a, b held) int {
+	n := 0
+	switch c.sortBy {
+	case sortMtime:
+		n = a.when.Compare(b.when)
+	case sortSize:
+		n = cmp.Compare(a.size, b.size)
+	case sortLength:
+		n = cmp.Compare(a.chars, b.chars)
+	case sortCount:
+		n = cmp.Compare(c.counts[a.hash], c.counts[b.hash])
+	case sortPath, sortNone:
+	}
+	if n == 0 {
+		n = strings.Compare(a.path, b.path)
+	}
+	return n
+}
+
+// release sorts and outputs the buffered comments, then removes any spill file.
+func (c *Config) release() {
+	if len(c.held) == 0 {
+		return
+	}
+	slices.SortStableFunc(c.held, func(a, b held) int {
+		if c.Reverse {
+			return c.compare(b, a)
+		}
+		return c.compare(a, b)
+	})
+	for _, h := range c.held {
+		f, err := c.unspill(h)
+		if err != nil {
+			c.Error(err)
+			continue
+		}
+		c.emit(f, h.mod)
+	}
+	c.held, c.heldMem = nil, 0
+	if c.spilled != nil {
+		c.spilled.Close()
+		os.Remove(c.spilled.Name())
+		c.spilled = nil
+	}
+}
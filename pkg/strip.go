@@ -0,0 +1,109 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrStrip is returned when both the Strip and Write configs are used.
+	ErrStrip = errors.New("strip cannot be used with write")
+	// ErrHashes is returned when the Hashes file has no SHA-256 checksums.
+	ErrHashes = errors.New("hashes file has no sha256 checksums")
+)
+
+// parseStrip compiles the Match config and reads the checksums of the Hashes file.
+func (c *Config) parseStrip() error {
+	if c.Match != "" {
+		re, err := regexp.Compile(c.Match)
+		if err != nil {
+			return fmt.Errorf("strip match: %w", err)
+		}
+		c.match = re
+	}
+	if c.Hashes == "" {
+		return nil
+	}
+	sums, err := readSums(c.Hashes)
+	if err != nil {
+		return err
+	}
+	c.sums = sums
+	return nil
+}
+
+// readSums returns the SHA-256 checksums of the named file, which are the first field
+// of each line. This reads the sha256 column of the csv and tsv formats, and sha256sum files.
+// Any lines without a checksum, such as a table heading, are ignored.
+func readSums(name string) (map[[32]byte]bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("strip hashes: %w", err)
+	}
+	defer f.Close()
+	sums := make(map[[32]byte]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ',' || r == '\t' || r == ' '
+		})
+		for _, field := range fields {
+			b, err := hex.DecodeString(strings.Trim(field, `"`))
+			if err != nil || len(b) != len([32]byte{}) {
+				continue
+			}
+			sums[[32]byte(b)] = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("strip hashes %s: %w", name, err)
+	}
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrHashes, name)
+	}
+	return sums, nil
+}
+
+// strippable reports whether the archive comment matches the Match or Hashes configs.
+// Every comment is strippable when neither config is used.
+func (c *Config) strippable(cmmt []byte) bool {
+	if c.match == nil && c.sums == nil {
+		return true
+	}
+	if len(cmmt) == 0 {
+		return false
+	}
+	s, err := decode(string(cmmt))
+	if err != nil {
+		s = string(cmmt)
+	}
+	if c.match != nil && c.match.MatchString(s) {
+		return true
+	}
+	return c.sums[sum(s)]
+}
+
+// entries returns the number of file entries with a comment in the named zip archive.
+func entries(path string) int {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0
+	}
+	defer r.Close()
+	n := 0
+	for _, f := range r.File {
+		if f.Comment != "" {
+			n++
+		}
+	}
+	return n
+}
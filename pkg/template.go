@@ -0,0 +1,134 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// ErrTemplate is returned when a template cannot be parsed.
+var ErrTemplate = errors.New("template")
+
+// The names of the parsed templates.
+const (
+	tmplResult = "result"
+	tmplHeader = "header"
+	tmplFooter = "footer"
+)
+
+// funcs are the helper functions available to the templates.
+var funcs = template.FuncMap{
+	"base":     filepath.Base,
+	"indent":   indent,
+	"wrap":     wrap,
+	"trim":     strings.TrimSpace,
+	"humanize": func(n int64) string { return humanize.Bytes(uint64(max(n, 0))) },
+}
+
+// indent prefixes every line of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", max(n, 0))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrap breaks the lines of s that are longer than the width at the last space.
+func wrap(width int, s string) string {
+	if width <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		var sb strings.Builder
+		n := 0
+		for j, word := range strings.Split(line, " ") {
+			l := len([]rune(word))
+			if j > 0 {
+				if n > 0 && n+1+l > width {
+					sb.WriteString("\n")
+					n = 0
+				} else {
+					sb.WriteString(" ")
+					n++
+				}
+			}
+			sb.WriteString(word)
+			n += l
+		}
+		lines[i] = sb.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readTemplate returns the text of the named template file,
+// or the value itself when it is an inline template.
+// Inline templates end with a newline.
+func readTemplate(s string) (string, error) {
+	if info, err := os.Stat(s); err == nil && info.Mode().IsRegular() {
+		b, err := os.ReadFile(s)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrTemplate, err)
+		}
+		return string(b), nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) && !strings.Contains(s, "{{") {
+		return "", fmt.Errorf("%w: %w", ErrTemplate, err)
+	}
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s, nil
+}
+
+// parseTemplate parses the Template, Header and Footer configs.
+func (c *Config) parseTemplate() error {
+	t := template.New(tmplResult).Funcs(funcs)
+	for name, s := range map[string]string{
+		tmplResult: c.Template,
+		tmplHeader: c.Header,
+		tmplFooter: c.Footer,
+	} {
+		if s == "" {
+			continue
+		}
+		text, err := readTemplate(s)
+		if err != nil {
+			return err
+		}
+		if _, err := t.New(name).Parse(text); err != nil {
+			return fmt.Errorf("%w %s: %w", ErrTemplate, name, err)
+		}
+	}
+	c.tmpl = t
+	return nil
+}
+
+// execute renders the named template to the output, when it exists.
+func (c *Config) execute(name string, data any) {
+	if c.tmpl == nil || c.tmpl.Lookup(name) == nil {
+		return
+	}
+	if err := c.tmpl.ExecuteTemplate(c.writer(), name, data); err != nil {
+		c.Error(fmt.Errorf("%w %s: %w", ErrTemplate, name, err))
+	}
+}
+
+// header renders the header template with the Status counters at the start of a scan.
+func (c *Config) header() {
+	if c.format != formatTemplate {
+		return
+	}
+	c.execute(tmplHeader, c.Totals())
+}
@@ -0,0 +1,280 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/fsnotify/fsnotify"
+)
+
+// settle is the default duration that a new or modified zip archive
+// must be left unchanged before Watch reads its comment.
+const settle = 2 * time.Second
+
+type (
+	// pending is a zip archive that is waiting for its writes to settle.
+	pending struct {
+		gen   int
+		timer *time.Timer
+	}
+	// settled is a zip archive that has not been written to for the Settle duration.
+	settled struct {
+		name string
+		gen  int
+	}
+	// scanned is the size and modification time of a zip archive read by Watch.
+	scanned struct {
+		size int64
+		mod  int64
+	}
+)
+
+// SetReady sets a channel that is closed once Watch has finished the scan
+// and is watching the directories for new zip archives.
+func (i *internal) SetReady(ready chan struct{}) {
+	i.ready = ready
+}
+
+// Watch walks the directories provided by the Arg slice, the same as WalkDirs,
+// and then continues to watch the directories for any new or modified zip archives.
+// The comments of those archives are printed and saved once the writes have settled.
+// The directories are watched before the walk, so the archives that are created
+// during the walk are not missed. Watch returns once the context is cancelled.
+func (c *Config) Watch(ctx context.Context) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c.watch = true
+	defer c.closeStore()
+	defer c.closeDB()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	defer w.Close()
+	for _, root := range c.Dirs {
+		if err := c.watchDir(w, root, nil); err != nil {
+			c.Error(err)
+		}
+	}
+	early := queue(w)
+	c.WalkDirsContext(ctx)
+	events, errs := early()
+	if ctx.Err() != nil {
+		return nil
+	}
+	defer c.saveCache()
+	defer c.saveHashDB()
+	if c.ready != nil {
+		close(c.ready)
+	}
+	delay := c.Settle
+	if delay <= 0 {
+		delay = settle
+	}
+	waits := make(map[string]*pending)
+	ready := make(chan settled)
+	wait := func(name string) {
+		p, ok := waits[name]
+		if !ok {
+			p = &pending{}
+			waits[name] = p
+		}
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.gen++
+		gen := p.gen
+		p.timer = time.AfterFunc(delay, func() {
+			select {
+			case ready <- settled{name: name, gen: gen}:
+			case <-ctx.Done():
+			}
+		})
+	}
+	for _, err := range errs {
+		c.Error(fmt.Errorf("watch: %w", err))
+	}
+	// the archives read by the walk are skipped by watched, unless they were modified
+	for _, e := range events {
+		c.event(w, e, wait)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for _, p := range waits {
+				p.timer.Stop()
+			}
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			c.Error(fmt.Errorf("watch: %w", err))
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			c.event(w, e, wait)
+		case s := <-ready:
+			if p, ok := waits[s.name]; !ok || p.gen != s.gen {
+				continue
+			}
+			delete(waits, s.name)
+			c.watched(s.name)
+		}
+	}
+}
+
+// queue collects the notifications of the watched directories in the background,
+// while the directories are walked. The returned func stops the collection and returns
+// a single event for each notified path, in the order they were first notified.
+func queue(w *fsnotify.Watcher) func() ([]fsnotify.Event, []error) {
+	stop, done := make(chan struct{}), make(chan struct{})
+	ops := make(map[string]fsnotify.Op)
+	var names []string
+	var errs []error
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if _, ok := ops[e.Name]; !ok {
+					names = append(names, e.Name)
+				}
+				ops[e.Name] |= e.Op
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				errs = append(errs, err)
+			}
+		}
+	}()
+	return func() ([]fsnotify.Event, []error) {
+		close(stop)
+		<-done
+		events := make([]fsnotify.Event, 0, len(names))
+		for _, name := range names {
+			events = append(events, fsnotify.Event{Name: name, Op: ops[name]})
+		}
+		return events, errs
+	}
+}
+
+// event handles the file system notification of a watched directory.
+// New or modified zip archives are passed to the wait func.
+func (c *Config) event(w *fsnotify.Watcher, e fsnotify.Event, wait func(string)) {
+	if !e.Has(fsnotify.Create) && !e.Has(fsnotify.Write) {
+		return
+	}
+	info, err := os.Stat(e.Name)
+	if err != nil {
+		return
+	}
+	if c.hidden(e.Name, fs.FileInfoToDirEntry(info)) {
+		return
+	}
+	if !info.IsDir() {
+		if cmnt.Valid(e.Name) {
+			wait(e.Name)
+		}
+		return
+	}
+	if c.NoWalk || !e.Has(fsnotify.Create) {
+		return
+	}
+	// a new subdirectory, which may have been moved with its zip archives
+	if err := c.watchDir(w, e.Name, wait); err != nil {
+		c.Error(err)
+	}
+}
+
+// watched reads, prints and saves the comment of the settled zip archive.
+// Archives that are unchanged since they were last read are skipped.
+func (c *Config) watched(name string) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return
+	}
+	if !c.changed(name, info) {
+		return
+	}
+	c.WriteLog("WATCH: " + c.display(name))
+	c.archive(name, fs.FileInfoToDirEntry(info))
+	c.flush()
+	c.release()
+	c.commitDB()
+	c.site()
+	c.writeBundle()
+}
+
+// changed reports whether the named zip archive is new or modified since it was last read,
+// and records its size and modification time.
+func (c *Config) changed(name string, info fs.FileInfo) bool {
+	if c.scans == nil {
+		c.scans = make(map[string]scanned)
+	}
+	s := scanned{size: info.Size(), mod: info.ModTime().UnixNano()}
+	if prev, ok := c.scans[name]; ok && prev == s {
+		return false
+	}
+	c.scans[name] = s
+	return true
+}
+
+// watchDir adds the root directory and its subdirectories to the watcher.
+// Any zip archives found in the subdirectories are passed to the optional wait func.
+func (c *Config) watchDir(w *fsnotify.Watcher, root string, wait func(string)) error {
+	if c.NoWalk {
+		if err := w.Add(root); err != nil {
+			return fmt.Errorf("watch %s: %w", root, err)
+		}
+		return nil
+	}
+	dev, xdev := c.device(root)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) && path != root {
+				return nil
+			}
+			return err
+		}
+		if path != root && c.hidden(path, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if wait != nil && cmnt.Valid(d.Name()) {
+				wait(path)
+			}
+			return nil
+		}
+		if xdev && path != root && c.mount(path, d, dev) {
+			return fs.SkipDir
+		}
+		if err := w.Add(path); err != nil {
+			c.Error(fmt.Errorf("watch %s: %w", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("watch %s: %w", root, err)
+	}
+	return nil
+}
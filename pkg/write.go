@@ -0,0 +1,184 @@
+// © Ben Garrett https://github.com/bengarrett/zipcmt
+
+package zipcmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bengarrett/zipcmt/internal/zipedit"
+	"github.com/gookit/color"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var (
+	// ErrWrite is returned when the Write mode is unknown.
+	ErrWrite = errors.New("unknown write mode, use set, append or prepend")
+	// ErrWriteEmpty is returned when the set Write mode is used with an empty Comment.
+	ErrWriteEmpty = errors.New("write comment is empty, use strip to remove the comments")
+)
+
+// backupExt is the file extension of the Backup copies of rewritten archives.
+const backupExt = ".bak"
+
+// mode of the Write config.
+type mode uint8
+
+const (
+	writeNone    mode = iota // read the comments
+	writeSet                 // replace the comments
+	writeAppend              // add the text to the end of the comments
+	writePrepend             // add the text to the start of the comments
+	writeStrip               // remove the comments
+)
+
+func parseWrite(s string) (mode, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return writeNone, nil
+	case "set", "replace":
+		return writeSet, nil
+	case "append":
+		return writeAppend, nil
+	case "prepend":
+		return writePrepend, nil
+	}
+	return writeNone, fmt.Errorf("%w: %q", ErrWrite, s)
+}
+
+// stamp returns the text of the Comment config used by the write mode.
+// The text is checked once before the scan, so an empty text in the set mode,
+// which would erase every comment, or an overlong text is never written.
+func (c *Config) stamp(w mode) ([]byte, error) {
+	b, err := c.stampText()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > zipedit.MaxComment {
+		return nil, fmt.Errorf("write comment: %w", zipedit.ErrLength)
+	}
+	if len(b) == 0 && w == writeSet {
+		return nil, ErrWriteEmpty
+	}
+	return b, nil
+}
+
+// stampText returns the text of the Comment config, which is read from a file when it
+// is prefixed by @. The Encode config converts the Unicode text to CP437.
+func (c *Config) stampText() ([]byte, error) {
+	b := []byte(c.Comment)
+	if name, ok := strings.CutPrefix(c.Comment, "@"); ok {
+		var err error
+		if b, err = os.ReadFile(name); err != nil {
+			return nil, fmt.Errorf("write comment: %w", err)
+		}
+	}
+	if !c.Encode {
+		return b, nil
+	}
+	p, err := charmap.CodePage437.NewEncoder().Bytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("write comment, the text cannot be encoded as cp437: %w", err)
+	}
+	return p, nil
+}
+
+// join adds the text to the comment using the newline style of the comment.
+func join(cmmt, text []byte) []byte {
+	if len(cmmt) == 0 {
+		return bytes.Clone(text)
+	}
+	if len(text) == 0 {
+		return bytes.Clone(cmmt)
+	}
+	nl := []byte("\n")
+	if bytes.Contains(cmmt, []byte("\r\n")) || bytes.Contains(text, []byte("\r\n")) {
+		nl = []byte("\r\n")
+	}
+	b := bytes.Clone(cmmt)
+	if !bytes.HasSuffix(b, []byte("\n")) && !bytes.HasPrefix(text, []byte("\n")) &&
+		!bytes.HasPrefix(text, []byte("\r\n")) {
+		b = append(b, nl...)
+	}
+	return append(b, text...)
+}
+
+// rewrite sets, appends, prepends or strips the comment of the named zip archive.
+// Only the archive comment and any stripped entry comments are rewritten,
+// and the archive is replaced atomically.
+func (c *Config) rewrite(path string) {
+	old, err := zipedit.Read(path)
+	if err != nil {
+		if !errors.Is(err, zipedit.ErrEOCD) {
+			c.Error(err)
+		}
+		c.fault(path, err)
+		return
+	}
+	var cmmt []byte
+	n := 0
+	switch c.mode {
+	case writeStrip:
+		if !c.strippable(old) {
+			return
+		}
+		if c.Entries {
+			n = entries(path)
+		}
+	case writeSet:
+		cmmt = c.text
+	case writeAppend:
+		cmmt = join(old, c.text)
+	case writePrepend:
+		cmmt = join(c.text, old)
+	case writeNone:
+		return
+	}
+	if bytes.Equal(cmmt, old) && n == 0 {
+		return
+	}
+	change := fmt.Sprintf("%s %d byte comment", c.Write, len(cmmt))
+	if c.mode == writeStrip {
+		change = fmt.Sprintf("strip %d byte comment", len(old))
+		if n > 0 {
+			change += fmt.Sprintf(", %d entry comments", n)
+		}
+	}
+	c.written++
+	if c.DryRun {
+		fmt.Fprintf(c.writer(), "%s\t%s\n", c.display(path), change)
+		return
+	}
+	opt := zipedit.Options{
+		Keep:    c.mode == writeStrip,
+		Entries: n > 0,
+	}
+	if c.Backup {
+		opt.Backup = path + backupExt
+	}
+	if err := zipedit.Write(path, cmmt, opt); err != nil {
+		c.written--
+		c.Error(fmt.Errorf("%s: %w", c.display(path), err))
+		return
+	}
+	c.WriteLog(fmt.Sprintf("WRITE: %s (%s)", c.display(path), change))
+	if s := c.Separator(path); s != "" {
+		fmt.Fprint(os.Stdout, s)
+		fmt.Fprintln(os.Stdout, color.Secondary.Sprint("   "+change))
+	}
+}
+
+// verb returns the past tense of the rewrite mode used by the Status summary.
+func (c *Config) verb() string {
+	s := "updated"
+	if c.mode == writeStrip {
+		s = "stripped"
+	}
+	if c.DryRun {
+		return "would have " + s
+	}
+	return s
+}
@@ -5,24 +5,34 @@ package zipcmt
 
 import (
 	"archive/zip"
-	"crypto/sha256"
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/bengarrett/retrotxtgo/byter"
 	"github.com/bengarrett/sauce"
 	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/bengarrett/zipcmt/internal/fuzzy"
+	"github.com/bengarrett/zipcmt/internal/hashdb"
 	humanize "github.com/dustin/go-humanize"
 	"github.com/gookit/color"
 	"golang.org/x/text/encoding/charmap"
 )
 
+const (
+	fileID   = 45        // fileID is the width of the named file separator.
+	resetCmd = "\033[0m" // resetCmd is the ANSI control to reset the text colors and styles.
+)
+
 // Config zipcmt to walk one or more directories.
 type Config struct {
 	internal
@@ -37,6 +47,120 @@ type Config struct {
 	// which is otherwise applied to the comment text file.
 	Now    bool
 	NoWalk bool // NoWalk ignores all subdirectories while scanning for zip archives.
+	// Count the zip archives before the scan to show a progress bar with an estimated time of completion.
+	Count bool
+	// Cache the comments of the scanned zip archives to a file used by WalkDirs.
+	// Later scans read the comments of any unchanged archives from the cache, instead of opening them.
+	// The archives within the Dirs that are no longer found are removed from the cache.
+	// The cache is kept in memory during the scan.
+	Cache bool
+	Cold  bool // Cold ignores any previously cached comments, but the Cache is still updated.
+	// Settle is the duration that a new or modified zip archive must be left unchanged
+	// before Watch reads its comment. The default is 2 seconds.
+	Settle time.Duration
+	// Normalize is a comma-separated list of the steps applied to the comments before they are
+	// hashed to find duplicates. The steps are eol, space, ansi, case, dates, phones or all.
+	Normalize string
+	// Similar is the minimum similarity, between 0 and 1, for a comment to be a near duplicate
+	// of a previously found comment. Near duplicates are reported but not shown or saved.
+	// The default 0 disables the check.
+	Similar float64
+	// Keep is the owner policy of duplicate comments, which decides the archive used to print
+	// and save a comment. It is either first (the default, in walk order), oldest, newest,
+	// shortest-path or largest. Except for first, the comments are printed after the scan.
+	Keep string
+	// Format of the scan results written to stdout, either text (the default), json, ndjson, csv or tsv.
+	// The json format writes a single document once the scan is finished, while ndjson
+	// writes a line for each comment and error as they are found, then a summary.
+	// The csv and tsv formats write a table row for each unique comment as it is found.
+	// All formats except text disable the colour and the progress output.
+	Format string
+	// List prints the paths of the zip archives with a comment, one per line, instead of the comments.
+	// ListEmpty prints the paths of the zip archives without a comment.
+	// Print0 terminates each listed path with a NUL character instead of a newline, for use with xargs -0.
+	List      bool
+	ListEmpty bool
+	Print0    bool
+	// Template renders each unique comment using a Go text/template, which is either a file path
+	// or an inline template. The data is a Record with the helper functions base, indent, wrap, trim and
+	// humanize. Header and Footer are optional templates rendered with the Totals of the scan.
+	Template string
+	Header   string
+	Footer   string
+	// Text includes the comment text as the last column of the csv and tsv formats.
+	Text bool
+	// DB is the path of a SQLite database that catalogues every scanned archive and comment,
+	// with a full-text search index of the comments. Repeated scans update the database.
+	DB string
+	// Bundle is an optional file path to write every found comment into a single text file.
+	// Each comment has a header with its source path and date.
+	Bundle string
+	// TOC adds a table of contents to the start of the Bundle file.
+	TOC bool
+	// Sort the comments of all the Dirs once the scan is finished, by either path, mtime, size,
+	// length or count, which is the number of archives that share the comment. The orders are
+	// ascending, so use Reverse for the newest, largest, longest or most used comments first.
+	Sort    string
+	Reverse bool
+	// Limit the number of comments that are printed and saved, when it is more than zero.
+	Limit int
+	// Paths is the style of the displayed zip archive paths, either relative, absolute or home.
+	// Relative paths are based on the directory of Dirs that contains the archive, or the Base.
+	// Home paths are absolute with the home directory replaced by a tilde. Otherwise, the paths
+	// are shown as they were walked, with the home directory replaced by a tilde, except by
+	// the lists and the machine readable formats that keep the walked paths unchanged.
+	Paths string
+	// Base is the directory used by the relative Paths style, which is implied when it is set.
+	Base string
+	// Write the comment of every zip archive instead of reading it, with a mode of either set,
+	// append or prepend. The Comment is the text, or a file path when it is prefixed with @.
+	// The set mode needs a Comment, use Strip to remove the comments.
+	// Encode converts the Comment to CP437. Backup keeps a copy of each rewritten archive with
+	// a .bak extension, which replaces any older copy. Only the archive comment is rewritten,
+	// the entries are not recompressed.
+	Write   string
+	Comment string
+	Encode  bool
+	Backup  bool
+	// Strip clears the comment of every zip archive instead of reading it.
+	// Match is an optional regular expression, and Hashes is an optional file of SHA-256
+	// checksums from a previous scan, that limit the stripping to the matching comments.
+	// Entries also clears the comments of the file entries. The modification times of the
+	// stripped archives are kept. DryRun lists the archives that Strip or Write would change.
+	Strip   bool
+	Match   string
+	Hashes  string
+	Entries bool
+	DryRun  bool
+	// HTML is an optional directory path to write a static site of the found comments.
+	HTML string
+	// Report groups the zip archives by their comments. After the scan, each unique comment
+	// is printed once with the paths of every archive that uses it, sorted by the most used.
+	// Unless Print is set, only the paths are listed. The Dupes config is ignored when Report is set.
+	Report bool
+	// Dedup is the store of the unique comment hashes, either memory (the default), disk or bloom.
+	// The disk store keeps the hashes in a temporary file using a small and fixed amount of memory,
+	// but it cannot be used with a Checkpoint. The bloom store is a Bloom filter that needs about 2 bytes
+	// for each unique comment, but a few unique comments will be ignored at the FalsePositive rate.
+	Dedup string
+	// FalsePositive is the rate of unique comments that are ignored as duplicates by the bloom Dedup store.
+	// The default rate is 0.001 (0.1%).
+	FalsePositive float64
+	// HashDB is an optional file path to a database of comment hashes used by WalkDirs.
+	// It keeps the comments found by previous scans, so only new comments are shown.
+	// The database is not used when Dupes is set.
+	HashDB string
+	// Checkpoint is an optional file path used by WalkDirs to periodically save the progress of the scan.
+	// An interrupted scan of the same directories is resumed from the saved progress.
+	// It cannot be used with the Bundle, HTML, Report, Sort or json Format outputs,
+	// which are collected in memory until the scan is finished.
+	Checkpoint string
+	// OneFileSystem skips any subdirectories that are stored on a different
+	// device to the root directory, such as mount points and network drives.
+	OneFileSystem bool
+	// Hidden includes the hidden files and directories, such as dot files,
+	// the recycle bin and the System Volume Information of Windows drives.
+	Hidden bool
 	Raw    bool // Raw uses the original comment text encoding (CP437, ISO-8859...) instead of Unicode.
 	Print  bool // Print found comments to stdout.
 	Quiet  bool // Quiet suppresses the scan activity feedback to stdout.
@@ -46,12 +170,59 @@ type Config struct {
 
 type internal struct {
 	test    bool
+	cancel  bool
 	log     string
 	names   uint
 	saved   int
 	exports cmnt.Export
-	hashes  hash
+	hashes  store
 	timer   time.Time
+	root    int                 // root is the index of the Dirs being walked.
+	skip    string              // skip the paths up to this completed zip archive of a resumed scan.
+	resumed bool                // resumed is true when the scan was resumed from a checkpoint.
+	last    string              // last is the path of the most recently completed zip archive.
+	point   time.Time           // point is the time of the last saved checkpoint.
+	cache   cache               // cache of the zip archive comments.
+	hashdb  *hashdb.DB          // hashdb is the database of comment hashes from previous scans.
+	norm    fuzzy.Norm          // norm are the normalization steps applied to comments before hashing.
+	similar *fuzzy.Index        // similar is the index of the unique comments used to find near duplicates.
+	near    int                 // near are the number of near duplicate comments found.
+	parsed  bool                // parsed is true once the Normalize, Similar, Keep, Paths, Write, Sort and Format configs are parsed.
+	invalid error               // invalid are the errors of the parsed configs.
+	keep    keep                // keep is the owner policy of duplicate comments.
+	format  format              // format of the scan results written to stdout.
+	records []Record            // records are the scan results of the JSON format.
+	out     io.Writer           // out is the writer of the streamed formats.
+	table   *csv.Writer         // table is the writer of the csv and tsv formats.
+	cat     *catalogue          // cat is the SQLite catalogue of the DB config.
+	tmpl    *template.Template  // tmpl are the parsed Template, Header and Footer configs.
+	bundled []bundled           // bundled are the comments of the Bundle file.
+	sortBy  order               // sortBy is the order of the Sort config.
+	style   style               // style of the displayed paths of the Paths config.
+	mode    mode                // mode of the Write config.
+	text    []byte              // text is the comment used by the Write config.
+	written int                 // written are the number of rewritten zip archives.
+	match   *regexp.Regexp      // match is the compiled Match config.
+	sums    map[[32]byte]bool   // sums are the checksums of the Hashes config.
+	held    []held              // held are the buffered comments of the Sort config.
+	heldMem int                 // heldMem is the size of the held comments in memory.
+	spilled *os.File            // spilled is the temporary file of the held comments.
+	counts  map[[32]byte]int    // counts are the number of archives that share a comment.
+	shown   int                 // shown are the number of comments output.
+	owners  map[[32]byte]*owner // owners are the buffered comments of the Keep config.
+	order   int                 // order is the number of owners that have been buffered.
+	groups  map[[32]byte]*group
+	watch   bool               // watch is true when WalkDirs is run by Watch.
+	ready   chan struct{}      // ready is closed once Watch is watching the directories.
+	scans   map[string]scanned // scans are the zip archives read by Watch.
+	hits    int                // hits are the number of zip archives served from the cache.
+	total   int                // total is the expected number of zip archives to scan.
+	base    int                // base is the number of zip archives scanned before the progress began.
+	bar     bool               // bar shows the progress bar instead of a counter.
+	begin   time.Time          // begin is the start time of the progress.
+	drawn   time.Time          // drawn is the time of the last progress bar update.
+
+	cacheName string
 }
 
 // SetLog sets the full path to a new log file with a name based on the current date and time.
@@ -88,6 +259,14 @@ type (
 		mod  time.Time
 		ow   bool
 	}
+	// found is the comment of a zip archive found by the scan.
+	found struct {
+		path string    // path of the zip archive.
+		cmmt string    // cmmt is the comment, using the encoding of the Raw config.
+		raw  string    // raw is the comment in its original encoding.
+		size int64     // size of the zip archive in bytes.
+		mod  time.Time // mod is the last modification time of the zip archive.
+	}
 )
 
 var (
@@ -105,6 +284,15 @@ var (
 // The Raw config will return the comment in its original legacy encoding.
 // Otherwise the comment is returned as Unicode text.
 func Read(name string, raw bool) (string, error) {
+	cmmt, err := readRaw(name)
+	if err != nil || raw {
+		return cmmt, err
+	}
+	return decode(cmmt)
+}
+
+// readRaw returns the zip comment of the named file in its original encoding.
+func readRaw(name string) (string, error) {
 	r, err := zip.OpenReader(name)
 	if err != nil {
 		return "", ErrRead
@@ -121,10 +309,11 @@ func Read(name string, raw bool) (string, error) {
 	if strings.TrimSpace(cmmt) == "" {
 		return "", nil
 	}
+	return cmmt, nil
+}
 
-	if raw {
-		return cmmt, nil
-	}
+// decode returns the raw comment as Unicode text, without any SAUCE metadata.
+func decode(cmmt string) (string, error) {
 	p := []byte(cmmt)
 	if ok := sauce.Contains(p); ok {
 		cmmt = string(sauce.Trim(p))
@@ -138,22 +327,98 @@ func Read(name string, raw bool) (string, error) {
 
 // WalkDirs walks the directories provided by the Arg slice for zip archives to extract any found comments.
 func (c *Config) WalkDirs() {
+	c.WalkDirsContext(context.Background())
+}
+
+// WalkDirsContext is the same as WalkDirs, but it stops walking the directories
+// once the context is cancelled. Any comment being saved is completed before it returns.
+func (c *Config) WalkDirsContext(ctx context.Context) {
 	c.init()
+	if err := c.Validate(); err != nil {
+		c.Error(err)
+		return
+	}
+	if !c.watch {
+		defer c.closeStore()
+	}
 	// sanitize the export directory
 	if err := c.Clean(); err != nil {
 		c.Error(err)
 	}
+	// resume an interrupted scan
+	start, err := c.resume()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := c.openHashDB(); err != nil {
+		c.Error(err)
+		return
+	}
+	defer c.saveHashDB()
+	if err := c.openDB(); err != nil {
+		c.Error(err)
+		return
+	}
+	if !c.watch {
+		defer c.closeDB()
+	}
+	c.loadCache()
+	defer c.saveCache()
+	c.estimate(ctx)
+	c.header()
 	// walk through the directories provided
-	for _, root := range c.Dirs {
-		_ = c.WalkDir(root)
+	for i, root := range c.Dirs {
+		if i < start {
+			continue
+		}
+		if i > start {
+			// the last completed archive of the resumed root may no longer exist
+			c.last, c.skip = "", ""
+		}
+		c.root = i
+		if err := c.WalkDirContext(ctx, root); err != nil && c.cancel {
+			c.saveCheckpoint()
+			break
+		}
+	}
+	// the owners are kept by the checkpoint of a cancelled scan
+	if !c.cancel || c.Checkpoint == "" {
+		c.flush()
+	}
+	c.release()
+	if c.Report && !c.Machine() {
+		c.WriteReport(os.Stdout)
+	}
+	c.site()
+	c.writeBundle()
+	if !c.cancel {
+		c.removeCheckpoint()
 	}
 }
 
 // WalkDir walks the root directory for zip archives and to extract any found comments.
+// The temporary file of a disk Dedup store that is created by WalkDir is removed once it returns.
 // The returned error is only used for testing purposes.
-func (c *Config) WalkDir(root string) error { //nolint: cyclop,funlen,gocognit
+func (c *Config) WalkDir(root string) error {
+	return c.WalkDirContext(context.Background(), root)
+}
+
+// WalkDirContext is the same as WalkDir, but the context is checked between each archive
+// and the walk is stopped once it is cancelled.
+func (c *Config) WalkDirContext(ctx context.Context, root string) error { //nolint: cyclop
+	if c.hashes == nil {
+		defer c.closeStore()
+	}
 	c.init()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	dev, xdev := c.device(root)
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
 			if errors.Is(err, fs.ErrPermission) {
 				// skip permission errors for subdirectories
@@ -164,6 +429,23 @@ func (c *Config) WalkDir(root string) error { //nolint: cyclop,funlen,gocognit
 			}
 			return err
 		}
+		// skip mount points and the directories of other devices
+		if xdev && d.IsDir() && path != root {
+			if c.mount(path, d, dev) {
+				return fs.SkipDir
+			}
+		}
+		// skip hidden files and directories
+		if path != root && c.hidden(path, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// skip the completed paths of a resumed scan
+		if skip, err := c.skipped(path, d); skip {
+			return err
+		}
 		// skip directories and non-zip files
 		if d.IsDir() || !cmnt.Valid(d.Name()) {
 			return nil
@@ -172,69 +454,140 @@ func (c *Config) WalkDir(root string) error { //nolint: cyclop,funlen,gocognit
 		if c.NoWalk && filepath.Dir(path) != filepath.Dir(root) {
 			return nil
 		}
-		c.Zips++
-		if !c.test && !c.Print && !c.Quiet {
-			fmt.Fprint(os.Stdout, "\r", color.Secondary.Sprint("Scanned "),
-				color.Primary.Sprintf("%d zip archives", c.Zips))
-		}
-		// read zip file comment
-		cmmt, err := Read(path, c.Raw)
-		if err != nil {
-			if !errors.Is(err, ErrRead) {
-				c.Error(err)
+		defer c.completed(path)
+		if c.watch {
+			if info, err := d.Info(); err == nil {
+				c.changed(path, info)
 			}
-			return nil
 		}
-		if cmmt == "" {
-			return nil
+		c.archive(path, d)
+		return nil
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		c.cancel = true
+		c.WriteLog("CANCELLED: " + root)
+		return fmt.Errorf("walk dir %w: %s", err, root)
+	}
+	if errs := walkErrs(root, err); errs != nil {
+		color.Error.Tips(fmt.Sprint(errs))
+	}
+	if err != nil {
+		return fmt.Errorf("walk dir %w: %s", err, root)
+	}
+	return nil
+}
+
+// archive reads, prints and saves the comment of the named zip archive.
+func (c *Config) archive(path string, d fs.DirEntry) {
+	c.Zips++
+	c.progress()
+	if c.mode != writeNone {
+		c.rewrite(path)
+		return
+	}
+	// read zip file comment
+	f, hash, err := c.read(path, d)
+	if err != nil {
+		if !errors.Is(err, ErrRead) {
+			c.Error(err)
+			return
 		}
-		// hash the comment
-		if !c.Dupes {
-			hash := sha256.Sum256([]byte(strings.TrimSpace(cmmt)))
-			if c.hashes[hash] {
-				return nil
-			}
-			c.hashes[hash] = true
+		c.fault(path, err)
+		return
+	}
+	c.catalogue(f)
+	cmmt := f.cmmt
+	if cmmt == "" {
+		if c.ListEmpty {
+			c.list(path)
+		}
+		return
+	}
+	// hash the comment
+	if !c.Dupes || c.Report {
+		if c.norm != 0 || hash == [32]byte{} {
+			hash = sum(c.norm.Apply(cmmt))
+		}
+		if c.hashes.Has(hash) {
+			c.grouped(hash, path, cmmt)
+			c.tally(hash, cmmt)
+			c.contest(hash, f)
+			c.record(f, true, nil)
+			return
+		}
+		c.hashes.Add(hash)
+		if c.nearDupe(path, cmmt) {
+			return
 		}
-		c.Cmmts++
-		// print the comment
+		c.addHash(hash, path)
+	}
+	c.Cmmts++
+	c.grouped(hash, path, cmmt)
+	c.tally(hash, cmmt)
+	// hold the comment until the scan is finished to decide the owner
+	if c.buffer(hash, f) {
+		return
+	}
+	c.output(f, c.lastMod(f))
+}
+
+// output prints and saves the found comment,
+// unless it is held until the end of the scan to be sorted.
+// The mod time is applied to any saved text files, unless it is zero.
+func (c *Config) output(f found, mod time.Time) {
+	if c.hold(f, mod) {
+		return
+	}
+	c.emit(f, mod)
+}
+
+// emit prints and saves the found comment,
+// until the Limit number of comments have been output.
+func (c *Config) emit(f found, mod time.Time) {
+	if c.Limit > 0 && c.shown >= c.Limit {
+		return
+	}
+	c.shown++
+	path, cmmt := f.path, f.cmmt
+	// print the comment, unless it is printed in the report or a format
+	if !c.Report && !c.Machine() {
 		fmt.Fprint(os.Stdout, c.Separator(path))
 		if c.Print {
 			stdout(cmmt)
 		}
-		// save the comment to a text file
-		dat := save{
-			name: "",
-			src:  path,
-			cmmt: cmmt,
-			mod:  c.lastMod(d),
-			ow:   c.Overwrite,
-		}
-		if c.Export {
-			dat.name = cmnt.ExportName(path)
-			if c.save(dat) {
-				c.WriteLog("SAVED: " + dat.name + humanize.Bytes(uint64(len(cmmt))))
-				c.saved++
-			}
-		}
-		if c.SaveName != "" {
-			dat.name = c.exports.Unique(path, c.SaveName)
-			c.names += uint(len(dat.name))
-			if c.save(dat) {
-				c.WriteLog(fmt.Sprintf("SAVED: %s (%s) << %s",
-					dat.name, humanize.Bytes(uint64(len(cmmt))), path))
-				c.saved++
-			}
+	}
+	c.bundle(f)
+	saved := []string{}
+	defer func() {
+		c.record(f, false, saved)
+	}()
+	// save the comment to a text file
+	dat := save{
+		name: "",
+		src:  path,
+		cmmt: cmmt,
+		mod:  mod,
+		ow:   c.Overwrite,
+	}
+	if c.Export {
+		dat.name = cmnt.ExportName(path)
+		if c.save(dat) {
+			c.WriteLog(fmt.Sprintf("SAVED: %s (%s) << %s",
+				dat.name, humanize.Bytes(uint64(len(cmmt))), c.display(path)))
+			c.saved++
+			saved = append(saved, dat.name)
 		}
-		return err
-	})
-	if errs := walkErrs(root, err); errs != nil {
-		color.Error.Tips(fmt.Sprint(errs))
 	}
-	if err != nil {
-		return fmt.Errorf("walk dir %w: %s", err, root)
+	if c.SaveName != "" {
+		dat.name = c.exports.Unique(path, c.SaveName)
+		c.names += uint(len(dat.name))
+		if c.save(dat) {
+			c.WriteLog(fmt.Sprintf("SAVED: %s (%s) << %s",
+				dat.name, humanize.Bytes(uint64(len(cmmt))), c.display(path)))
+			c.saved++
+			saved = append(saved, dat.name)
+		}
 	}
-	return nil
 }
 
 func walkErrs(root string, err error) error {
@@ -297,16 +650,20 @@ func (c *Config) Clean() error {
 
 // Separator prints and stylises the named file.
 func (c *Config) Separator(name string) string {
-	if !c.Print || c.Quiet {
+	return c.separator(c.display(name))
+}
+
+// separator prints and stylises the text.
+func (c *Config) separator(name string) string {
+	if !c.Print || c.Quiet || c.Machine() {
 		return ""
 	}
-	const fileID = 45
+	return heading(name)
+}
+
+// heading stylises the text as a separator.
+func heading(name string) string {
 	const pointer = " \u2500\u2500 "
-	if dir, err := os.UserHomeDir(); err == nil {
-		if len(name) > len(dir) && name[0:len(dir)] == dir {
-			name = strings.Replace(name, dir, "~", 1)
-		}
-	}
 	l := len(pointer) + len(name)
 	if l >= fileID {
 		return fmt.Sprintf("%s%s\n", pointer, name)
@@ -314,6 +671,16 @@ func (c *Config) Separator(name string) string {
 	return fmt.Sprintf("\n%s%s %s\u2510\n", pointer, name, strings.Repeat("\u2500", fileID-l))
 }
 
+// home replaces the home directory of the named file with a tilde.
+func (c *Config) home(name string) string {
+	if dir, err := os.UserHomeDir(); err == nil {
+		if len(name) > len(dir) && name[0:len(dir)] == dir {
+			name = strings.Replace(name, dir, "~", 1)
+		}
+	}
+	return name
+}
+
 // Status summarizes the zip files scan.
 func (c *Config) Status() string {
 	if c.Log {
@@ -322,6 +689,9 @@ func (c *Config) Status() string {
 			c.WriteLog(s)
 		}
 		s := fmt.Sprintf("Scan finished, time taken: %s", c.Timer())
+		if c.cancel {
+			s = fmt.Sprintf("Scan cancelled, time taken: %s", c.Timer())
+		}
 		c.WriteLog(s)
 	}
 	if c.Quiet {
@@ -341,14 +711,33 @@ func (c *Config) Status() string {
 	if !c.test && !c.Print {
 		s = "\r"
 	}
+	if c.bar {
+		s += clearEOL
+	}
+	if c.cancel {
+		s += color.Warn.Sprint("Cancelled! ")
+	}
 	s += color.Secondary.Sprint("Scanned ") +
 		color.Primary.Sprintf("%d zip %s", c.Zips, a)
+	if c.hits > 0 {
+		s += color.Secondary.Sprint(", ") +
+			color.Primary.Sprintf("%d cached", c.hits)
+	}
 	if c.SaveName != "" && c.saved != c.Cmmts {
 		s += color.Secondary.Sprint(", saved ") +
 			color.Primary.Sprintf("%d text files", c.saved)
 	}
-	s += color.Secondary.Sprint(" and found ") +
-		color.Primary.Sprintf("%d %s%s", c.Cmmts, unq, cm)
+	if c.mode != writeNone {
+		s += color.Secondary.Sprintf(" and %s ", c.verb()) +
+			color.Primary.Sprintf("%d archives", c.written)
+	} else {
+		s += color.Secondary.Sprint(" and found ") +
+			color.Primary.Sprintf("%d %s%s", c.Cmmts, unq, cm)
+	}
+	if c.near > 0 {
+		s += color.Secondary.Sprint(", ignoring ") +
+			color.Primary.Sprintf("%d near duplicates", c.near)
+	}
 	if !c.test {
 		s += color.Secondary.Sprint(", taking ") +
 			color.Primary.Sprintf("%s", c.Timer()) + "\n"
@@ -356,28 +745,170 @@ func (c *Config) Status() string {
 	return s
 }
 
+// device returns the device ID of the root directory when the OneFileSystem config is set.
+// The ok value is false if the config is unset or the device cannot be determined.
+func (c *Config) device(root string) (uint64, bool) {
+	if !c.OneFileSystem {
+		return 0, false
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return 0, false
+	}
+	return device(info)
+}
+
+// mount reports whether the directory is stored on a different device to dev.
+// Any matches are recorded to the log.
+func (c *Config) mount(path string, d fs.DirEntry, dev uint64) bool {
+	if !otherDevice(d, dev) {
+		return false
+	}
+	c.WriteLog("SKIP (mount point): " + c.display(path))
+	return true
+}
+
+// otherDevice reports whether the directory is stored on a different device to dev.
+func otherDevice(d fs.DirEntry, dev uint64) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	id, ok := device(info)
+	return ok && id != dev
+}
+
+// hidden reports whether the named file or directory should be skipped,
+// unless the Hidden config is set.
+func (c *Config) hidden(path string, d fs.DirEntry) bool {
+	if c.Hidden {
+		return false
+	}
+	if cmnt.Hidden(path) {
+		return true
+	}
+	return hiddenAttr(d)
+}
+
+// nearDupe reports whether the comment is a near duplicate of a previously found comment.
+// Any matches are printed and recorded to the log.
+func (c *Config) nearDupe(path, cmmt string) bool {
+	if c.similar == nil {
+		return false
+	}
+	sig := fuzzy.Sign(cmmt)
+	match, sim, ok := c.similar.Match(sig)
+	if !ok {
+		c.similar.Add(path, sig)
+		return false
+	}
+	c.near++
+	const pct = 100
+	c.WriteLog(fmt.Sprintf("NEAR DUPLICATE (%.0f%%): %s << %s", sim*pct, c.display(path), c.display(match)))
+	if s := c.Separator(path); s != "" {
+		fmt.Fprint(os.Stdout, s)
+		fmt.Fprintln(os.Stdout, color.Secondary.Sprintf("   near duplicate (%.0f%%) of ", sim*pct)+
+			color.Primary.Sprint(c.display(match)))
+	}
+	return true
+}
+
 // init initialise the Config maps.
 func (c *Config) init() {
+	if c.Validate() != nil {
+		return
+	}
 	if c.exports == nil {
 		c.exports = make(cmnt.Export)
 	}
 	if c.hashes == nil {
-		c.hashes = make(hash)
+		c.hashes = c.store()
 	}
 }
 
-// lastMod preserves the zip files last modification date.
-func (c *Config) lastMod(file fs.DirEntry) time.Time {
-	zero := time.Date(0o001, 1, 1, 0o0, 0o0, 0o0, 0o0, time.UTC)
-	if c.Now {
-		return zero
+// Validate parses the Keep, Paths, Write, Strip, Sort, Format, Template, Normalize and Dedup configs.
+// It returns the errors of any invalid values, which stop WalkDirs and Watch before they scan.
+func (c *Config) Validate() error {
+	if c.parsed {
+		return c.invalid
+	}
+	c.parsed = true
+	var errs []error
+	k, err := parseKeep(c.Keep)
+	if err != nil {
+		errs = append(errs, err)
 	}
-	i, err := file.Info()
+	c.keep = k
+	p, err := parseStyle(c.Paths)
 	if err != nil {
-		c.Error(err)
-		return zero
+		errs = append(errs, err)
+	}
+	if p == pathWalked && c.Base != "" {
+		p = pathRelative
+	}
+	c.style = p
+	w, err := parseWrite(c.Write)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if w != writeNone {
+		if c.text, err = c.stamp(w); err != nil {
+			errs = append(errs, err)
+			w = writeNone
+		}
+	}
+	if c.Strip {
+		if w != writeNone {
+			errs = append(errs, ErrStrip)
+		}
+		w = writeStrip
+		if err := c.parseStrip(); err != nil {
+			errs = append(errs, err)
+			w = writeNone
+		}
 	}
-	return i.ModTime()
+	c.mode = w
+	o, err := parseSort(c.Sort)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.sortBy = o
+	f, err := parseFormat(c.Format)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if (c.List || c.ListEmpty) && f == formatText {
+		f = formatList
+	}
+	if c.Template != "" && f == formatText {
+		if err := c.parseTemplate(); err != nil {
+			errs = append(errs, err)
+		} else {
+			f = formatTemplate
+		}
+	}
+	c.setFormat(f)
+	norm, err := fuzzy.ParseNorm(c.Normalize)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.norm = norm
+	if c.Similar > 0 {
+		c.similar = &fuzzy.Index{Threshold: c.Similar}
+	}
+	if err := parseDedup(c.Dedup); err != nil {
+		errs = append(errs, err)
+	}
+	c.invalid = errors.Join(errs...)
+	return c.invalid
+}
+
+// lastMod preserves the zip files last modification date.
+func (c *Config) lastMod(f found) time.Time {
+	if c.Now {
+		return time.Time{}
+	}
+	return f.mod
 }
 
 // save a zip cmmt to the file path.
@@ -403,7 +934,8 @@ func (c *Config) save(dat save) bool {
 	defer dst.Close()
 	if !dat.mod.IsZero() {
 		defer func() {
-			if err := os.Chtimes(dat.name, time.Now(), dat.mod); err != nil {
+			err := os.Chtimes(dat.name, time.Now(), dat.mod)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
 				c.Error(fmt.Errorf("%s: %w", dat.name, err))
 			}
 		}()
@@ -417,6 +949,10 @@ func (c *Config) save(dat save) bool {
 	written, err := io.CopyBuffer(dst, strings.NewReader(dat.cmmt), buf)
 	if err != nil {
 		c.Error(fmt.Errorf("%s: %w", dat.name, err))
+		// roll back any partially written text file
+		if written > 0 {
+			_ = os.Remove(dat.name)
+		}
 		return false
 	}
 	if written == 0 {
@@ -429,6 +965,13 @@ func (c *Config) save(dat save) bool {
 
 // stdout prints the cmmt with an ANSI reset command.
 func stdout(cmmt string) {
-	const resetCmd = "\033[0m"
-	fmt.Fprintf(os.Stdout, "%s%s\n", cmmt, resetCmd)
+	fmt.Fprintf(os.Stdout, "%s%s\n", cmmt, reset())
+}
+
+// reset returns the ANSI reset command, or an empty string when the colors are disabled.
+func reset() string {
+	if !color.Enable {
+		return ""
+	}
+	return resetCmd
 }
@@ -3,9 +3,25 @@
 package zipcmt_test
 
 import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/bengarrett/zipcmt/internal/cmnt"
+	"github.com/bengarrett/zipcmt/internal/fuzzy"
 	zipcmt "github.com/bengarrett/zipcmt/pkg"
 	"github.com/gookit/color"
 )
@@ -216,3 +232,1539 @@ func TestConfig_Status(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_OneFileSystem(t *testing.T) {
+	tests := []struct {
+		name     string
+		xdev     bool
+		wantZips int
+	}{
+		{"default", false, 4},
+		{"xdev", true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				OneFileSystem: tt.xdev,
+				Quiet:         true,
+			}
+			c.SetTest()
+			if err := c.WalkDir("../test"); err != nil {
+				t.Errorf("Config.WalkDir() error = %v", err)
+			}
+			if c.Zips != tt.wantZips {
+				t.Errorf("Config.WalkDir() zips = %d, want %d", c.Zips, tt.wantZips)
+			}
+		})
+	}
+}
+
+func TestConfig_WalkDirContext(t *testing.T) {
+	color.Enable = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := zipcmt.Config{
+		Dirs: []string{"../test"},
+	}
+	c.SetTest()
+	if err := c.WalkDirContext(ctx, "../test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Config.WalkDirContext() error = %v, want %v", err, context.Canceled)
+	}
+	if c.Zips != 0 {
+		t.Errorf("Config.WalkDirContext() zips = %d, want 0", c.Zips)
+	}
+	c.WalkDirsContext(ctx)
+	const want = "Cancelled! Scanned 0 zip archives and found 0 unique comments"
+	if got := strings.TrimSpace(c.Status()); got != want {
+		t.Errorf("Config.Status() = \ngot:  %v,\nwant: %v", got, want)
+	}
+}
+
+func TestConfig_Checkpoint(t *testing.T) {
+	// the fields share the names of the checkpoint gob
+	type checkpoint struct {
+		Dirs  []string
+		Index int
+		Path  string
+		Zips  int
+		Cmmts int
+	}
+	tests := []struct {
+		name      string
+		dirs      []string
+		wantZips  int
+		wantCmmts int
+	}{
+		{"resume", []string{"../test"}, 4, 2},
+		{"mismatch", []string{"../test/subdir"}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "zipcmt.checkpoint")
+			f, err := os.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cp := checkpoint{
+				Dirs:  []string{"../test"},
+				Path:  filepath.Join("..", "test", "subdir", "test-with-comment.zip"),
+				Zips:  2,
+				Cmmts: 1,
+			}
+			if err := gob.NewEncoder(f).Encode(cp); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			c := zipcmt.Config{
+				Dirs:       tt.dirs,
+				Checkpoint: name,
+				Dupes:      true,
+				Quiet:      true,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			if c.Zips != tt.wantZips || c.Cmmts != tt.wantCmmts {
+				t.Errorf("Config.WalkDirs() zips, cmmts = %d, %d, want %d, %d",
+					c.Zips, c.Cmmts, tt.wantZips, tt.wantCmmts)
+			}
+			// a finished scan removes the checkpoint
+			if _, err := os.Stat(name); (err == nil) != (tt.wantZips == 0) {
+				t.Errorf("Config.WalkDirs() checkpoint stat error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_CheckpointGone(t *testing.T) {
+	// the fields share the names of the checkpoint gob
+	type checkpoint struct {
+		Dirs  []string
+		Index int
+		Path  string
+		Zips  int
+	}
+	base := t.TempDir()
+	z, a := filepath.Join(base, "z"), filepath.Join(base, "a")
+	for _, dir := range []string{z, a} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createZip(t, filepath.Join(z, "done.zip"), "")
+	createZip(t, filepath.Join(a, "1.zip"), "")
+	createZip(t, filepath.Join(a, "2.zip"), "")
+	// the last completed archive was removed before the scan was resumed
+	name := filepath.Join(t.TempDir(), "zipcmt.checkpoint")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := checkpoint{
+		Dirs: []string{z, a},
+		Path: filepath.Join(z, "gone.zip"),
+		Zips: 1,
+	}
+	if err := gob.NewEncoder(f).Encode(cp); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	c := zipcmt.Config{
+		Dirs:       []string{z, a},
+		Checkpoint: name,
+		Quiet:      true,
+	}
+	c.SetTest()
+	c.WalkDirs()
+	if c.Zips != 3 {
+		t.Errorf("Config.WalkDirs() zips = %d, want 3", c.Zips)
+	}
+}
+
+func TestConfig_Cache(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cache.gob")
+	tests := []struct {
+		name     string
+		cold     bool
+		wantHits int
+	}{
+		{"first", false, 0},
+		{"cached", false, 4},
+		{"cold", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Dirs:  []string{"../test"},
+				Cache: true,
+				Cold:  tt.cold,
+				Quiet: true,
+			}
+			c.SetTest()
+			c.SetCache(name)
+			c.WalkDirs()
+			if got := c.Hits(); got != tt.wantHits {
+				t.Errorf("Config.Hits() = %d, want %d", got, tt.wantHits)
+			}
+			if c.Zips != 4 || c.Cmmts != 1 {
+				t.Errorf("Config.WalkDirs() zips, cmmts = %d, %d, want 4, 1", c.Zips, c.Cmmts)
+			}
+		})
+	}
+}
+
+func TestConfig_CachePrune(t *testing.T) {
+	dir, moved := t.TempDir(), t.TempDir()
+	name := filepath.Join(t.TempDir(), "cache.gob")
+	src, err := os.ReadFile("../test/test-with-comment.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, zip := range []string{"a.zip", "b.zip"} {
+		if err := os.WriteFile(filepath.Join(dir, zip), src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan := func() int {
+		c := zipcmt.Config{
+			Dirs:  []string{dir},
+			Cache: true,
+			Quiet: true,
+		}
+		c.SetTest()
+		c.SetCache(name)
+		c.WalkDirs()
+		return c.Hits()
+	}
+	scan()
+	// the strip mode does not read the cache, so it is not pruned
+	c := zipcmt.Config{
+		Dirs:   []string{dir},
+		Cache:  true,
+		Strip:  true,
+		DryRun: true,
+		Quiet:  true,
+	}
+	c.SetTest()
+	c.SetCache(name)
+	c.SetOutput(io.Discard)
+	c.WalkDirs()
+	if got := scan(); got != 2 {
+		t.Errorf("Config.Hits() after the strip = %d, want 2", got)
+	}
+	// the moved archive is pruned from the cache by a complete scan
+	if err := os.Rename(filepath.Join(dir, "b.zip"), filepath.Join(moved, "b.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if got := scan(); got != 1 {
+		t.Errorf("Config.Hits() = %d, want 1", got)
+	}
+	// so the unchanged archive is reread once it is restored
+	if err := os.Rename(filepath.Join(moved, "b.zip"), filepath.Join(dir, "b.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if got := scan(); got != 1 {
+		t.Errorf("Config.Hits() after the restore = %d, want 1", got)
+	}
+	if got := scan(); got != 2 {
+		t.Errorf("Config.Hits() after the reread = %d, want 2", got)
+	}
+}
+
+func TestConfig_Watch(t *testing.T) {
+	dir, save := t.TempDir(), t.TempDir()
+	src, err := os.ReadFile("../test/test-with-comment.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the archive read by the initial scan is not read again when it is rewritten unchanged
+	old := filepath.Join(dir, "old.zip")
+	if err := os.WriteFile(old, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := zipcmt.Config{
+		Dirs:     []string{dir},
+		SaveName: save,
+		Dupes:    true,
+		Quiet:    true,
+		Settle:   50 * time.Millisecond,
+	}
+	c.SetTest()
+	ready := make(chan struct{})
+	c.SetReady(ready)
+	done := make(chan error)
+	go func() {
+		done <- c.Watch(ctx)
+	}()
+	const timeout = 10 * time.Second
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("Config.Watch() returned before it was ready, error = %v", err)
+	case <-time.After(timeout):
+		t.Fatal("Config.Watch() was not ready before the timeout")
+	}
+	if err := os.WriteFile(old, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(old, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.zip"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// poll for the saved comment of the new archive
+	want := filepath.Join(save, "new"+cmnt.Filename)
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(want); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Config.Watch() did not save %s before the timeout", want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Config.Watch() error = %v", err)
+	}
+	if c.Zips != 2 || c.Cmmts != 2 {
+		t.Errorf("Config.Watch() zips, cmmts = %d, %d, want 2, 2", c.Zips, c.Cmmts)
+	}
+}
+
+// walkWriter is the output of a watch, which runs the create func on its first write.
+type walkWriter struct {
+	mu     sync.Mutex
+	sb     strings.Builder
+	create func()
+}
+
+func (w *walkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.create != nil {
+		w.create()
+		w.create = nil
+	}
+	return w.sb.Write(p)
+}
+
+func (w *walkWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sb.String()
+}
+
+func TestConfig_WatchWalk(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.ReadFile("../test/test-with-comment.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.zip"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the new archive is created during the initial scan, after its directory was read
+	w := &walkWriter{create: func() {
+		if err := os.WriteFile(filepath.Join(dir, "new.zip"), src, 0o644); err != nil {
+			t.Error(err)
+		}
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := zipcmt.Config{
+		Dirs:   []string{dir},
+		Format: "ndjson",
+		Dupes:  true,
+		Quiet:  true,
+		Settle: 50 * time.Millisecond,
+	}
+	c.SetTest()
+	c.SetOutput(w)
+	done := make(chan error)
+	go func() {
+		done <- c.Watch(ctx)
+	}()
+	const timeout = 10 * time.Second
+	deadline := time.Now().Add(timeout)
+	for !strings.Contains(w.String(), "new.zip") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Config.Watch() did not read the archive created during the scan")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Config.Watch() error = %v", err)
+	}
+	if c.Zips != 2 {
+		t.Errorf("Config.Watch() zips = %d, want 2", c.Zips)
+	}
+}
+
+func TestConfig_WatchDB(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "zipcmt.sqlite")
+	// the scan is cancelled before Watch begins to watch the directories
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := zipcmt.Config{
+		Dirs:  []string{"../test"},
+		DB:    name,
+		Quiet: true,
+	}
+	c.SetTest()
+	if err := c.Watch(ctx); err != nil {
+		t.Errorf("Config.Watch() error = %v", err)
+	}
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	n := 0
+	if err := db.QueryRow("SELECT COUNT(*) FROM scans WHERE finished IS NOT NULL").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Config.Watch() finished scans = %d, want 1", n)
+	}
+}
+
+func TestConfig_Hidden(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.ReadFile("../test/test-with-comment.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".cache", "$RECYCLE.BIN", "public"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "file.zip"), src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		hidden   bool
+		wantZips int
+	}{
+		{"default", false, 1},
+		{"hidden", true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Hidden: tt.hidden,
+				Quiet:  true,
+			}
+			c.SetTest()
+			if err := c.WalkDir(dir); err != nil {
+				t.Errorf("Config.WalkDir() error = %v", err)
+			}
+			if c.Zips != tt.wantZips {
+				t.Errorf("Config.WalkDir() zips = %d, want %d", c.Zips, tt.wantZips)
+			}
+		})
+	}
+}
+
+func TestBar(t *testing.T) {
+	color.Enable = false
+	tests := []struct {
+		name    string
+		zips    int
+		total   int
+		done    int
+		elapsed time.Duration
+		want    string
+	}{
+		{"unknown", 5, 0, 5, time.Second, ""},
+		{"start", 0, 10, 0, 0, "░░░░░░░░░░░░░░░░░░░░░░░░░░░░░░   0% 0/10 zips"},
+		{"half", 5, 10, 5, 5 * time.Second,
+			"███████████████░░░░░░░░░░░░░░░  50% 5/10 zips, 1/s, ETA 5s"},
+		{"overflow", 12, 10, 12, time.Second,
+			"██████████████████████████████ 100% 10/10 zips, 12/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zipcmt.Bar(tt.zips, tt.total, tt.done, tt.elapsed); got != tt.want {
+				t.Errorf("Bar() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_HashDB(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hashes.gob")
+	tests := []struct {
+		name      string
+		wantCmmts int
+	}{
+		{"first", 1},
+		{"known", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Dirs:   []string{"../test"},
+				HashDB: name,
+				Quiet:  true,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			if c.Cmmts != tt.wantCmmts {
+				t.Errorf("Config.WalkDirs() cmmts = %d, want %d", c.Cmmts, tt.wantCmmts)
+			}
+		})
+	}
+}
+
+func TestConfig_ListHashDB(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "\xb0\xb1\xb2 BBS advert")
+	name := filepath.Join(t.TempDir(), "hashes.gob")
+	tests := []struct {
+		name      string
+		list      bool
+		wantCmmts int
+	}{
+		{"list", true, 1},
+		{"known", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				HashDB: name,
+				List:   tt.list,
+				Quiet:  true,
+			}
+			var sb strings.Builder
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if c.Cmmts != tt.wantCmmts {
+				t.Errorf("Config.WalkDirs() cmmts = %d, want %d", c.Cmmts, tt.wantCmmts)
+			}
+		})
+	}
+}
+
+func TestConfig_Normalize(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "Call The Underground BBS\r\n  (555) 555-1234")
+	createZip(t, filepath.Join(dir, "b.zip"), "Call the underground BBS\n(555) 555-9876")
+	tests := []struct {
+		name      string
+		normalize string
+		similar   float64
+		wantCmmts int
+	}{
+		{"default", "", 0, 2},
+		{"space", "space", 0, 2},
+		{"all", "all", 0, 1},
+		{"similar", "", 0.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Normalize: tt.normalize,
+				Similar:   tt.similar,
+				Quiet:     true,
+			}
+			c.SetTest()
+			if err := c.WalkDir(dir); err != nil {
+				t.Errorf("Config.WalkDir() error = %v", err)
+			}
+			if c.Cmmts != tt.wantCmmts {
+				t.Errorf("Config.WalkDir() cmmts = %d, want %d", c.Cmmts, tt.wantCmmts)
+			}
+		})
+	}
+}
+
+// createZip creates a zip archive with a single text file and the comment.
+func createZip(t *testing.T, name, comment string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	fw, err := w.Create("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfig_WriteReport(t *testing.T) {
+	color.Enable = false
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "BBS advert")
+	createZip(t, filepath.Join(dir, "b.zip"), "Group release")
+	createZip(t, filepath.Join(dir, "c.zip"), "Group release")
+	c := zipcmt.Config{
+		Report: true,
+		Dupes:  true,
+		Quiet:  true,
+	}
+	c.SetTest()
+	if err := c.WalkDir(dir); err != nil {
+		t.Errorf("Config.WalkDir() error = %v", err)
+	}
+	sb := strings.Builder{}
+	c.WriteReport(&sb)
+	want := "\n ── 2 archives " + strings.Repeat("─", 27) + "┐\n" +
+		"   • " + filepath.Join(dir, "b.zip") + "\n" +
+		"   • " + filepath.Join(dir, "c.zip") + "\n" +
+		"\n ── 1 archive " + strings.Repeat("─", 28) + "┐\n" +
+		"   • " + filepath.Join(dir, "a.zip") + "\n"
+	if got := sb.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("Config.WriteReport() = \ngot:  %q,\nwant: %q", got, want)
+	}
+	// the comments are printed with the headings
+	c.Print = true
+	sb.Reset()
+	c.WriteReport(&sb)
+	want = "\n ── 2 archives " + strings.Repeat("─", 27) + "┐\n" +
+		"Group release\n" +
+		"   • " + filepath.Join(dir, "b.zip") + "\n"
+	if got := sb.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("Config.WriteReport() with print = \ngot:  %q,\nwant: %q", got, want)
+	}
+}
+
+func TestConfig_Dedup(t *testing.T) {
+	tests := []struct {
+		name      string
+		dedup     string
+		wantCmmts int
+	}{
+		{"default", "", 1},
+		{"memory", "memory", 1},
+		{"disk", "disk", 1},
+		{"bloom", "bloom", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the temporary file of the disk store is removed by WalkDirs and WalkDir
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			c := zipcmt.Config{
+				Dirs:  []string{"../test"},
+				Dedup: tt.dedup,
+				Quiet: true,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			if c.Zips != 4 || c.Cmmts != tt.wantCmmts {
+				t.Errorf("Config.WalkDirs() zips, cmmts = %d, %d, want 4, %d", c.Zips, c.Cmmts, tt.wantCmmts)
+			}
+			w := zipcmt.Config{
+				Dedup: tt.dedup,
+				Quiet: true,
+			}
+			w.SetTest()
+			if err := w.WalkDir("../test"); err != nil {
+				t.Errorf("Config.WalkDir() error = %v", err)
+			}
+			if files, err := os.ReadDir(tmp); err != nil || len(files) != 0 {
+				t.Errorf("Config.WalkDir() left %d temporary files, %v", len(files), err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    zipcmt.Config
+		want error
+	}{
+		{"valid", zipcmt.Config{Format: "json", Keep: "oldest"}, nil},
+		{"dedup", zipcmt.Config{Dedup: "cloud"}, zipcmt.ErrDedup},
+		{"format", zipcmt.Config{Format: "jsn"}, zipcmt.ErrFormat},
+		{"keep", zipcmt.Config{Keep: "biggest"}, zipcmt.ErrKeep},
+		{"normalize", zipcmt.Config{Normalize: "tabs"}, fuzzy.ErrStep},
+		{"paths", zipcmt.Config{Paths: "short"}, zipcmt.ErrPaths},
+		{"sort", zipcmt.Config{Sort: "name"}, zipcmt.ErrSort},
+		{"write", zipcmt.Config{Write: "sett", Comment: "notice"}, zipcmt.ErrWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			c.Dirs = []string{"../test"}
+			c.Quiet = true
+			c.SetTest()
+			c.SetOutput(io.Discard)
+			if err := c.Validate(); !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("Config.Validate() error = %v, want %v", err, tt.want)
+			}
+			// an invalid config is not scanned
+			c.WalkDirs()
+			if got := c.Zips > 0; got != (tt.want == nil) {
+				t.Errorf("Config.WalkDirs() zips = %d, want scanned %v", c.Zips, tt.want == nil)
+			}
+			if err := c.WalkDir("../test"); !errors.Is(err, tt.want) {
+				t.Errorf("Config.WalkDir() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_DedupCheckpoint(t *testing.T) {
+	c := zipcmt.Config{
+		Dirs:       []string{"../test"},
+		Dedup:      "disk",
+		Checkpoint: filepath.Join(t.TempDir(), "scan.checkpoint"),
+		Quiet:      true,
+	}
+	c.SetTest()
+	c.WalkDirs()
+	if c.Zips != 0 {
+		t.Errorf("Config.WalkDirs() zips = %d, want 0 as the disk store cannot be checkpointed", c.Zips)
+	}
+}
+
+func TestConfig_CollectCheckpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        zipcmt.Config
+		wantZips bool
+	}{
+		{"bundle", zipcmt.Config{Bundle: filepath.Join(t.TempDir(), "bundle.txt")}, false},
+		{"html", zipcmt.Config{HTML: t.TempDir()}, false},
+		{"report", zipcmt.Config{Report: true}, false},
+		{"json", zipcmt.Config{Format: "json"}, false},
+		{"sort", zipcmt.Config{Sort: "size"}, false},
+		{"limit", zipcmt.Config{Limit: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			c.Dirs = []string{"../test"}
+			c.Checkpoint = filepath.Join(t.TempDir(), "scan.checkpoint")
+			c.Quiet = true
+			c.SetTest()
+			c.WalkDirs()
+			if got := c.Zips > 0; got != tt.wantZips {
+				t.Errorf("Config.WalkDirs() zips = %d, want scanned %v", c.Zips, tt.wantZips)
+			}
+		})
+	}
+}
+
+func TestConfig_Keep(t *testing.T) {
+	dir := t.TempDir()
+	deep := filepath.Join(dir, "a", "deep")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := filepath.Join(deep, "first.zip")
+	createZip(t, first, "BBS advert")
+	if err := os.Chtimes(first, old, old); err != nil {
+		t.Fatal(err)
+	}
+	createZip(t, filepath.Join(dir, "short.zip"), "BBS advert\n\n")
+	tests := []struct {
+		name string
+		keep string
+		want string
+	}{
+		{"first", "first", "first"},
+		{"oldest", "oldest", "first"},
+		{"newest", "newest", "short"},
+		{"shortest", "shortest-path", "short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			save := t.TempDir()
+			c := zipcmt.Config{
+				Dirs:     []string{dir},
+				Keep:     tt.keep,
+				SaveName: save,
+				Quiet:    true,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			if c.Cmmts != 1 {
+				t.Fatalf("Config.WalkDirs() cmmts = %d, want 1", c.Cmmts)
+			}
+			name := filepath.Join(save, tt.want+"-zipcomment.txt")
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("Config.WalkDirs() keep %q owner is not %s: %s", tt.keep, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Summary(t *testing.T) {
+	dir := t.TempDir()
+	const cmmt = "\xb0\xb1\xb2 BBS advert"
+	createZip(t, filepath.Join(dir, "a.zip"), cmmt)
+	createZip(t, filepath.Join(dir, "b.zip"), cmmt)
+	info, err := os.Stat(filepath.Join(dir, "a.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "cache.gob")
+	// the records of the cached archives match those of the opened archives
+	tests := []struct {
+		name     string
+		raw      bool
+		wantHits int
+	}{
+		{"opened", false, 0},
+		{"cached", false, 2},
+		{"cached raw", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				Format: "json",
+				Cache:  true,
+				Raw:    tt.raw,
+				Print:  true,
+			}
+			c.SetTest()
+			c.SetCache(name)
+			c.WalkDirs()
+			var sb strings.Builder
+			if err := c.Summary(&sb); err != nil {
+				t.Fatal(err)
+			}
+			var doc struct {
+				Results []zipcmt.Record `json:"results"`
+				Status  zipcmt.Totals   `json:"status"`
+			}
+			if err := json.Unmarshal([]byte(sb.String()), &doc); err != nil {
+				t.Fatalf("Config.Summary() is not valid json: %s", err)
+			}
+			if len(doc.Results) != 2 {
+				t.Fatalf("Config.Summary() results = %d, want 2", len(doc.Results))
+			}
+			a, b := doc.Results[0], doc.Results[1]
+			if a.Duplicate || !b.Duplicate {
+				t.Errorf("Config.Summary() duplicates = %v, %v, want false, true", a.Duplicate, b.Duplicate)
+			}
+			if string(a.Raw) != cmmt || a.Comment != "░▒▓ BBS advert" || a.Encoding != "cp437" {
+				t.Errorf("Config.Summary() comment = %q, %q, %q", a.Raw, a.Comment, a.Encoding)
+			}
+			if a.Size != info.Size() || !a.Modified.Equal(info.ModTime()) {
+				t.Errorf("Config.Summary() size, modified = %d, %s", a.Size, a.Modified)
+			}
+			if a.SHA256 != b.SHA256 || len(a.SHA256) != 64 {
+				t.Errorf("Config.Summary() sha256 = %q, %q", a.SHA256, b.SHA256)
+			}
+			if doc.Status.Zips != 2 || doc.Status.Comments != 1 || doc.Status.Cached != tt.wantHits {
+				t.Errorf("Config.Summary() status = %+v", doc.Status)
+			}
+		})
+	}
+}
+
+func TestConfig_NDJSON(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "BBS advert")
+	if err := os.WriteFile(filepath.Join(dir, "b.zip"), []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	c := zipcmt.Config{
+		Dirs:   []string{dir},
+		Format: "ndjson",
+		Print:  true,
+	}
+	c.SetTest()
+	c.SetOutput(&sb)
+	c.WalkDirs()
+	if err := c.Summary(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"comment", "error", "summary"}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Config.Summary() lines = %d, want %d: %q", len(lines), len(want), lines)
+	}
+	for i, line := range lines {
+		var rec struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d is not valid json: %s", i, err)
+		}
+		if rec.Type != want[i] {
+			t.Errorf("line %d type = %q, want %q", i, rec.Type, want[i])
+		}
+	}
+}
+
+func TestConfig_CSV(t *testing.T) {
+	dir := t.TempDir()
+	const cmmt = "BBS advert\nCall now"
+	createZip(t, filepath.Join(dir, "a.zip"), cmmt)
+	createZip(t, filepath.Join(dir, "b.zip"), cmmt)
+	tests := []struct {
+		name   string
+		format string
+		comma  rune
+		text   bool
+		cols   int
+	}{
+		{"csv", "csv", ',', false, 8},
+		{"tsv", "tsv", '\t', false, 8},
+		{"text", "csv", ',', true, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				Format: tt.format,
+				Text:   tt.text,
+				Print:  true,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if err := c.Summary(&sb); err != nil {
+				t.Fatal(err)
+			}
+			r := csv.NewReader(strings.NewReader(sb.String()))
+			r.Comma = tt.comma
+			rows, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the heading and a row for the unique comment
+			if len(rows) != 2 || len(rows[1]) != tt.cols {
+				t.Fatalf("Config.Summary() rows = %q", rows)
+			}
+			if rows[1][4] != "2" {
+				t.Errorf("Config.Summary() lines = %q, want 2", rows[1][4])
+			}
+			if tt.text && rows[1][8] != cmmt {
+				t.Errorf("Config.Summary() comment = %q, want %q", rows[1][8], cmmt)
+			}
+		})
+	}
+}
+
+func TestConfig_DB(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(t.TempDir(), "zipcmt.sqlite")
+	createZip(t, filepath.Join(dir, "a.zip"), "BBS advert")
+	createZip(t, filepath.Join(dir, "b.zip"), "BBS advert")
+	createZip(t, filepath.Join(dir, "c.zip"), "")
+	scan := func() {
+		c := zipcmt.Config{
+			Dirs:  []string{dir},
+			DB:    name,
+			Quiet: true,
+		}
+		c.SetTest()
+		c.WalkDirs()
+		if c.Zips == 0 {
+			t.Fatalf("Config.WalkDirs() zips = 0")
+		}
+	}
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	count := func(query string, args ...any) int {
+		t.Helper()
+		n := 0
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		return n
+	}
+	const (
+		archives = "SELECT count(*) FROM archives"
+		comments = "SELECT count(*) FROM comments"
+		links    = "SELECT count(*) FROM archive_comments"
+		search   = "SELECT count(*) FROM comments_fts WHERE comments_fts MATCH ?"
+		complete = "SELECT count(*) FROM scans WHERE complete = 1 AND finished IS NOT NULL"
+	)
+	scan()
+	if a, c, l := count(archives), count(comments), count(links); a != 3 || c != 1 || l != 2 {
+		t.Errorf("DB archives, comments, links = %d, %d, %d, want 3, 1, 2", a, c, l)
+	}
+	if n := count(search, "advert"); n != 1 {
+		t.Errorf("DB search advert = %d, want 1", n)
+	}
+	// a repeated scan upserts the archives
+	scan()
+	if a, c, s := count(archives), count(comments), count(complete); a != 3 || c != 1 || s != 2 {
+		t.Errorf("DB archives, comments, scans = %d, %d, %d, want 3, 1, 2", a, c, s)
+	}
+	// the strip mode does not catalogue the archives, so they are not pruned
+	strip := zipcmt.Config{
+		Dirs:   []string{dir},
+		DB:     name,
+		Strip:  true,
+		DryRun: true,
+		Quiet:  true,
+	}
+	strip.SetTest()
+	strip.SetOutput(io.Discard)
+	strip.WalkDirs()
+	if a, c := count(archives), count(comments); a != 3 || c != 1 {
+		t.Errorf("DB archives, comments after the strip = %d, %d, want 3, 1", a, c)
+	}
+	// the removed archives and the unused comments are pruned
+	for _, zip := range []string{"a.zip", "b.zip", "c.zip"} {
+		if err := os.Remove(filepath.Join(dir, zip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createZip(t, filepath.Join(dir, "a.zip"), "Group release")
+	scan()
+	if a, c, l := count(archives), count(comments), count(links); a != 1 || c != 1 || l != 1 {
+		t.Errorf("DB pruned archives, comments, links = %d, %d, %d, want 1, 1, 1", a, c, l)
+	}
+	if n := count(search, "advert"); n != 0 {
+		t.Errorf("DB search advert after the prune = %d, want 0", n)
+	}
+	if n := count(search, "release"); n != 1 {
+		t.Errorf("DB search release = %d, want 1", n)
+	}
+}
+
+func TestConfig_WriteSite(t *testing.T) {
+	dir, site := t.TempDir(), t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "BBS <advert>")
+	createZip(t, filepath.Join(dir, "b.zip"), "BBS <advert>")
+	createZip(t, filepath.Join(dir, "c.zip"), "\xb0\xb1\xb2")
+	c := zipcmt.Config{
+		Dirs:  []string{dir},
+		HTML:  site,
+		Quiet: true,
+	}
+	c.SetTest()
+	c.WalkDirs()
+	pages, err := filepath.Glob(filepath.Join(site, "comment", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Config.WriteSite() pages = %d, want 2", len(pages))
+	}
+	b, err := os.ReadFile(filepath.Join(site, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a.zip", "b.zip", "c.zip", "duplicate, 2 archives", "search.js"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Config.WriteSite() index.html does not contain %q", want)
+		}
+	}
+	b, err = os.ReadFile(filepath.Join(site, "search.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "const zipcmtIndex = [") || !strings.Contains(string(b), "░▒▓") {
+		t.Errorf("Config.WriteSite() search.js is missing the index")
+	}
+	for _, name := range pages {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "<advert>") {
+			t.Errorf("Config.WriteSite() %s comment is not escaped", name)
+		}
+	}
+	b, err = os.ReadFile(filepath.Join(site, "style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `url("font.ttf")`) {
+		t.Errorf("Config.WriteSite() style.css does not use the font")
+	}
+	for _, name := range []string{"font.ttf", "font.txt"} {
+		st, err := os.Stat(filepath.Join(site, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() == 0 {
+			t.Errorf("Config.WriteSite() %s is empty", name)
+		}
+	}
+}
+
+func TestConfig_Template(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "  BBS advert  ")
+	createZip(t, filepath.Join(dir, "b.zip"), "BBS advert")
+	name := filepath.Join(t.TempDir(), "footer.tmpl")
+	if err := os.WriteFile(name, []byte("{{.Zips}} zips, {{.Comments}} comments\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	c := zipcmt.Config{
+		Dirs:     []string{dir},
+		Template: `{{base .Path}}: {{trim .Comment | indent 2}} {{.Size | humanize}} {{.Encoding}}`,
+		Header:   "# comments",
+		Footer:   name,
+		Print:    true,
+	}
+	c.SetTest()
+	c.SetOutput(&sb)
+	c.WalkDirs()
+	if err := c.Summary(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := "# comments\na.zip:   BBS advert "
+	if got := sb.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("Config.Template = %q, want prefix %q", got, want)
+	}
+	if got := sb.String(); !strings.HasSuffix(got, " ascii\n2 zips, 1 comments\n") {
+		t.Errorf("Config.Template = %q, want the footer", got)
+	}
+}
+
+func TestConfig_WriteBundle(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "a.zip"), "BBS advert")
+	createZip(t, filepath.Join(dir, "b.zip"), "BBS advert")
+	createZip(t, filepath.Join(dir, "c.zip"), "\xb0\xb1\xb2")
+	tests := []struct {
+		name string
+		toc  bool
+		want []string
+	}{
+		{"bundle", false, []string{"1. " + filepath.Join(dir, "a.zip"), "BBS advert\n", "2. ", "░▒▓\n"}},
+		{"toc", true, []string{"Contents\n", "   2. " + filepath.Join(dir, "c.zip") + " ("}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "comments.txt")
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				Bundle: name,
+				TOC:    tt.toc,
+				Quiet:  true,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			b, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("Config.WriteBundle() does not contain %q", want)
+				}
+			}
+			if n := strings.Count(string(b), "BBS advert"); n != 1 {
+				t.Errorf("Config.WriteBundle() has %d duplicate comments, want 1", n)
+			}
+		})
+	}
+}
+
+func TestConfig_List(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.zip"), filepath.Join(dir, "b.zip"), filepath.Join(dir, "c.zip")
+	createZip(t, a, "BBS advert")
+	createZip(t, b, "BBS advert")
+	createZip(t, c, "")
+	tests := []struct {
+		name   string
+		list   bool
+		empty  bool
+		print0 bool
+		want   string
+	}{
+		{"list", true, false, false, a + "\n"},
+		{"print0", true, false, true, a + "\x00"},
+		{"empty", false, true, false, c + "\n"},
+		{"both", true, true, true, a + "\x00" + c + "\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:      []string{dir},
+				List:      tt.list,
+				ListEmpty: tt.empty,
+				Print0:    tt.print0,
+				Print:     true,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if err := c.Summary(&sb); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("Config.List = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_PlainPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, "zips")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "a.zip")
+	createZip(t, name, "BBS advert")
+	tilde := filepath.Join("~", "zips", "a.zip")
+	tests := []struct {
+		name   string
+		format string
+		paths  string
+		want   string
+	}{
+		{"list", "", "", name + "\n"},
+		{"list home", "", "home", tilde + "\n"},
+		{"csv", "csv", "", name},
+		{"ndjson", "ndjson", "", `"path":"` + name + `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				List:   tt.format == "",
+				Format: tt.format,
+				Paths:  tt.paths,
+				Print:  true,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if err := c.Summary(&sb); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); !strings.Contains(got, tt.want) {
+				t.Errorf("Config.Paths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		tty     bool
+		env     map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{"auto tty", "auto", true, nil, true, false},
+		{"auto pipe", "auto", false, nil, false, false},
+		{"default", "", true, nil, true, false},
+		{"dumb", "auto", true, map[string]string{"TERM": "dumb"}, false, false},
+		{"no color", "auto", true, map[string]string{"NO_COLOR": "1"}, false, false},
+		{"force color", "auto", false, map[string]string{"FORCE_COLOR": "1"}, true, false},
+		{"force off", "auto", true, map[string]string{"FORCE_COLOR": "0"}, false, false},
+		{"always", "always", false, map[string]string{"NO_COLOR": "1"}, true, false},
+		{"never", "never", true, map[string]string{"FORCE_COLOR": "1"}, false, false},
+		{"unknown", "sometimes", true, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string {
+				return tt.env[key]
+			}
+			got, err := zipcmt.UseColor(tt.mode, tt.tty, getenv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UseColor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UseColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Sort(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.zip"), filepath.Join(dir, "b.zip"), filepath.Join(dir, "c.zip")
+	createZip(t, a, "BBS advert")
+	createZip(t, b, "A much longer BBS advert")
+	createZip(t, c, "BBS")
+	createZip(t, filepath.Join(dir, "d.zip"), "BBS")
+	old := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(b, old, old); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sort    string
+		reverse bool
+		limit   int
+		want    string
+	}{
+		{"walk", "", false, 0, a + "\n" + b + "\n" + c + "\n"},
+		{"path reverse", "path", true, 0, c + "\n" + b + "\n" + a + "\n"},
+		{"length", "length", false, 0, c + "\n" + a + "\n" + b + "\n"},
+		{"size reverse", "size", true, 0, b + "\n" + a + "\n" + c + "\n"},
+		{"oldest", "mtime", false, 1, b + "\n"},
+		{"most used", "count", true, 1, c + "\n"},
+		{"limit", "", false, 2, a + "\n" + b + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:    []string{dir},
+				List:    true,
+				Sort:    tt.sort,
+				Reverse: tt.reverse,
+				Limit:   tt.limit,
+				Print:   true,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if got := sb.String(); got != tt.want {
+				t.Errorf("Config.Sort = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Paths(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(sub, "a.zip")
+	createZip(t, name, "BBS advert")
+	tests := []struct {
+		name  string
+		paths string
+		base  string
+		want  string
+	}{
+		{"walked", "", "", name},
+		{"absolute", "absolute", "", name},
+		{"relative", "relative", "", filepath.Join("sub", "a.zip")},
+		{"base", "", sub, "a.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:  []string{dir},
+				List:  true,
+				Paths: tt.paths,
+				Base:  tt.base,
+				Print: true,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			if got := sb.String(); got != tt.want+"\n" {
+				t.Errorf("Config.Paths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Write(t *testing.T) {
+	txt := filepath.Join(t.TempDir(), "notice.txt")
+	if err := os.WriteFile(txt, []byte("from a file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		cmmt    string
+		write   string
+		comment string
+		encode  bool
+		want    string
+	}{
+		{"set", "BBS advert", "set", "notice", false, "notice"},
+		{"set empty", "", "set", "notice", false, "notice"},
+		{"append", "BBS advert", "append", "notice", false, "BBS advert\nnotice"},
+		{"append crlf", "BBS\r\nadvert", "append", "notice", false, "BBS\r\nadvert\r\nnotice"},
+		{"prepend", "BBS advert", "prepend", "notice", false, "notice\nBBS advert"},
+		{"prepend empty", "", "prepend", "notice", false, "notice"},
+		{"file", "BBS advert", "set", "@" + txt, false, "from a file"},
+		{"cp437", "", "set", "░▒▓", true, "\xb0\xb1\xb2"},
+		{"unknown", "BBS advert", "insert", "notice", false, "BBS advert"},
+		{"set nothing", "BBS advert", "set", "", false, "BBS advert"},
+		{"set empty file", "BBS advert", "set", "@" + empty, false, "BBS advert"},
+		{"too long", "BBS advert", "append", strings.Repeat("x", 0x10000), false, "BBS advert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "a.zip")
+			createZip(t, name, tt.cmmt)
+			c := zipcmt.Config{
+				Dirs:    []string{dir},
+				Write:   tt.write,
+				Comment: tt.comment,
+				Encode:  tt.encode,
+			}
+			c.SetTest()
+			c.WalkDirs()
+			got, err := zipcmt.Read(name, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Config.Write = %q, want %q", got, tt.want)
+			}
+			if _, err := zip.OpenReader(name); err != nil {
+				t.Errorf("Config.Write archive is invalid: %s", err)
+			}
+		})
+	}
+	t.Run("backup", func(t *testing.T) {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "a.zip")
+		createZip(t, name, "BBS advert")
+		c := zipcmt.Config{Dirs: []string{dir}, Write: "set", Comment: "notice", Backup: true}
+		c.SetTest()
+		c.WalkDirs()
+		if got, _ := zipcmt.Read(name+".bak", true); got != "BBS advert" {
+			t.Errorf("Config.Backup = %q, want %q", got, "BBS advert")
+		}
+		if got := c.Totals().Written; got != 1 {
+			t.Errorf("Config.Write written = %d, want 1", got)
+		}
+		// a second run replaces the backup
+		c = zipcmt.Config{Dirs: []string{dir}, Write: "set", Comment: "notice 2", Backup: true}
+		c.SetTest()
+		c.WalkDirs()
+		if got, _ := zipcmt.Read(name, true); got != "notice 2" {
+			t.Errorf("Config.Write = %q, want %q", got, "notice 2")
+		}
+		if got, _ := zipcmt.Read(name+".bak", true); got != "notice" {
+			t.Errorf("Config.Backup = %q, want %q", got, "notice")
+		}
+	})
+}
+
+func TestConfig_Strip(t *testing.T) {
+	advert := sha256.Sum256([]byte("BBS advert"))
+	hashes := filepath.Join(t.TempDir(), "hashes.csv")
+	table := "path,sha256\nold.zip," + hex.EncodeToString(advert[:]) + "\n"
+	if err := os.WriteFile(hashes, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		cmmt   string
+		match  string
+		hashes string
+		dryRun bool
+		want   string
+	}{
+		{"strip", "BBS advert", "", "", false, ""},
+		{"match", "BBS advert", "(?i)bbs", "", false, ""},
+		{"no match", "Group release", "(?i)bbs", "", false, "Group release"},
+		{"hash", "BBS advert", "", hashes, false, ""},
+		{"no hash", "Group release", "", hashes, false, "Group release"},
+		{"dry run", "BBS advert", "", "", true, "BBS advert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "a.zip")
+			createZip(t, name, tt.cmmt)
+			if err := os.Chtimes(name, old, old); err != nil {
+				t.Fatal(err)
+			}
+			var sb strings.Builder
+			c := zipcmt.Config{
+				Dirs:   []string{dir},
+				Strip:  true,
+				Match:  tt.match,
+				Hashes: tt.hashes,
+				DryRun: tt.dryRun,
+			}
+			c.SetTest()
+			c.SetOutput(&sb)
+			c.WalkDirs()
+			got, err := zipcmt.Read(name, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Config.Strip = %q, want %q", got, tt.want)
+			}
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(old) {
+				t.Errorf("Config.Strip mod time = %s, want %s", info.ModTime(), old)
+			}
+			if list := sb.String(); tt.dryRun != (list != "") {
+				t.Errorf("Config.DryRun listing = %q", list)
+			}
+		})
+	}
+	t.Run("entries", func(t *testing.T) {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "a.zip")
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := zip.NewWriter(f)
+		if _, err := w.CreateHeader(&zip.FileHeader{Name: "file.txt", Comment: "BBS advert"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		c := zipcmt.Config{Dirs: []string{dir}, Strip: true, Entries: true}
+		c.SetTest()
+		c.WalkDirs()
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if got := r.File[0].Comment; got != "" {
+			t.Errorf("Config.Entries = %q, want none", got)
+		}
+		if got := c.Totals().Written; got != 1 {
+			t.Errorf("Config.Entries written = %d, want 1", got)
+		}
+	})
+}